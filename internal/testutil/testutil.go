@@ -0,0 +1,115 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testutil provides reproducible datasets for the tests and benchmarks of the
+// store packages. Datasets are drawn from a Source seeded deterministically, so a given
+// seed produces the same data across runs and machines.
+package testutil
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// A Source generates reproducible datasets.
+type Source struct {
+	rnd *rand.Rand
+}
+
+// New returns a Source seeded with seed.
+func New(seed int64) *Source {
+	return &Source{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Ints returns n non-negative pseudo-random ints.
+func (s *Source) Ints(n int) []int {
+	v := make([]int, n)
+	for i := range v {
+		v[i] = s.rnd.Int()
+	}
+	return v
+}
+
+// Intn returns n pseudo-random ints in [0, max).
+func (s *Source) Intn(n, max int) []int {
+	v := make([]int, n)
+	for i := range v {
+		v[i] = s.rnd.Intn(max)
+	}
+	return v
+}
+
+// Points returns n points with dims coordinates drawn uniformly from [0, 1).
+func (s *Source) Points(n, dims int) [][]float64 {
+	p := make([][]float64, n)
+	for i := range p {
+		p[i] = make([]float64, dims)
+		for d := range p[i] {
+			p[i][d] = s.rnd.Float64()
+		}
+	}
+	return p
+}
+
+// SortedPoints returns n points as for Points, sorted in lexical order of their
+// coordinates.
+func (s *Source) SortedPoints(n, dims int) [][]float64 {
+	p := s.Points(n, dims)
+	sort.Slice(p, func(i, j int) bool {
+		for d := range p[i] {
+			if p[i][d] != p[j][d] {
+				return p[i][d] < p[j][d]
+			}
+		}
+		return false
+	})
+	return p
+}
+
+// ClusteredPoints returns n points with dims coordinates distributed normally with
+// standard deviation spread around clusters centers drawn uniformly from [0, 1).
+// Points are assigned to centers in turn.
+func (s *Source) ClusteredPoints(n, dims, clusters int, spread float64) [][]float64 {
+	c := s.Points(clusters, dims)
+	p := make([][]float64, n)
+	for i := range p {
+		p[i] = make([]float64, dims)
+		for d := range p[i] {
+			p[i][d] = c[i%clusters][d] + s.rnd.NormFloat64()*spread
+		}
+	}
+	return p
+}
+
+// An Interval is a half-open integer interval.
+type Interval struct {
+	Start, End int
+}
+
+// Intervals returns n intervals with starts in [0, max) and lengths in [1, maxLen].
+func (s *Source) Intervals(n, max, maxLen int) []Interval {
+	v := make([]Interval, n)
+	for i := range v {
+		start := s.rnd.Intn(max)
+		v[i] = Interval{Start: start, End: start + s.rnd.Intn(maxLen) + 1}
+	}
+	return v
+}
+
+// An Edit describes the assignment of Val to the positions [Start, End) of a step vector.
+type Edit struct {
+	Start, End int
+	Val        int
+}
+
+// Edits returns n edits with starts in [start, end), lengths in [0, maxLen) and values in
+// [0, maxVal).
+func (s *Source) Edits(n, start, end, maxLen, maxVal int) []Edit {
+	v := make([]Edit, n)
+	for i := range v {
+		pos := start + s.rnd.Intn(end-start)
+		v[i] = Edit{Start: pos, End: pos + s.rnd.Intn(maxLen), Val: s.rnd.Intn(maxVal)}
+	}
+	return v
+}
@@ -0,0 +1,61 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+// Tests
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestReproducible(c *check.C) {
+	gen := func(seed int64) []interface{} {
+		src := New(seed)
+		return []interface{}{
+			src.Ints(100),
+			src.Intn(100, 10),
+			src.Points(100, 3),
+			src.SortedPoints(100, 2),
+			src.ClusteredPoints(100, 3, 4, 0.01),
+			src.Intervals(100, 1000, 10),
+			src.Edits(100, -50, 50, 10, 3),
+		}
+	}
+	c.Check(gen(1), check.DeepEquals, gen(1))
+	c.Check(gen(1), check.Not(check.DeepEquals), gen(2))
+}
+
+func (s *S) TestShapes(c *check.C) {
+	src := New(1)
+	for _, v := range src.Intn(1000, 10) {
+		c.Check(0 <= v && v < 10, check.Equals, true)
+	}
+	for _, p := range src.Points(1000, 3) {
+		c.Assert(p, check.HasLen, 3)
+		for _, v := range p {
+			c.Check(0 <= v && v < 1, check.Equals, true)
+		}
+	}
+	p := src.SortedPoints(1000, 2)
+	for i := 1; i < len(p); i++ {
+		c.Check(p[i-1][0] <= p[i][0], check.Equals, true)
+	}
+	for _, iv := range src.Intervals(1000, 100, 5) {
+		c.Check(0 <= iv.Start && iv.Start < 100, check.Equals, true)
+		c.Check(1 <= iv.End-iv.Start && iv.End-iv.Start <= 5, check.Equals, true)
+	}
+	for _, e := range src.Edits(1000, -50, 50, 10, 3) {
+		c.Check(-50 <= e.Start && e.Start < 50, check.Equals, true)
+		c.Check(0 <= e.End-e.Start && e.End-e.Start < 10, check.Equals, true)
+		c.Check(0 <= e.Val && e.Val < 3, check.Equals, true)
+	}
+}
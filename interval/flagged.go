@@ -0,0 +1,90 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package interval
+
+// A Flagged is a Range whose end points may each be open or closed.
+type Flagged interface {
+	Range
+	StartOpen() bool // Returns whether the start value is excluded from the range.
+	EndOpen() bool   // Returns whether the end value is excluded from the range.
+}
+
+// A FlaggedRange is a range with independently open or closed end points. A
+// FlaggedRange may be used as a query Overlapper for a Tree holding FlaggedIntervals
+// or any other Interface.
+type FlaggedRange struct {
+	Low, High         Comparable
+	LowOpen, HighOpen bool
+}
+
+// Start returns the start value of the range.
+func (r FlaggedRange) Start() Comparable { return r.Low }
+
+// End returns the end value of the range.
+func (r FlaggedRange) End() Comparable { return r.High }
+
+// StartOpen returns whether the start value is excluded from the range.
+func (r FlaggedRange) StartOpen() bool { return r.LowOpen }
+
+// EndOpen returns whether the end value is excluded from the range.
+func (r FlaggedRange) EndOpen() bool { return r.HighOpen }
+
+// Overlap returns whether r and b share at least one point. If b is a Flagged,
+// its end point flags are honoured, otherwise b is treated as closed at both ends.
+// Treating plain Ranges as closed ensures that the range extents held by Nodes,
+// which do not retain flags, never cause a matching interval to be pruned from a
+// tree traversal. An empty range, with equal end points and either end open,
+// overlaps nothing.
+func (r FlaggedRange) Overlap(b Range) bool {
+	var bStartOpen, bEndOpen bool
+	if f, ok := b.(Flagged); ok {
+		bStartOpen, bEndOpen = f.StartOpen(), f.EndOpen()
+	}
+	if isEmpty(r.Low, r.High, r.LowOpen, r.HighOpen) || isEmpty(b.Start(), b.End(), bStartOpen, bEndOpen) {
+		return false
+	}
+	return precedes(r.Low, b.End(), r.LowOpen || bEndOpen) &&
+		precedes(b.Start(), r.High, bStartOpen || r.HighOpen)
+}
+
+// isEmpty returns whether the range described by start, end and the open flags
+// contains no points.
+func isEmpty(start, end Comparable, startOpen, endOpen bool) bool {
+	c := start.Compare(end)
+	return c > 0 || (c == 0 && (startOpen || endOpen))
+}
+
+// precedes returns whether the start value s is before the end value e, allowing
+// equality only when neither touching end point is open.
+func precedes(s, e Comparable, open bool) bool {
+	c := s.Compare(e)
+	return c < 0 || (c == 0 && !open)
+}
+
+// A FlaggedInterval is a reference Interface implementation for intervals with
+// open or closed end points.
+type FlaggedInterval struct {
+	FlaggedRange
+	UID uintptr
+}
+
+// ID returns the unique ID of the interval.
+func (i *FlaggedInterval) ID() uintptr { return i.UID }
+
+// NewMutable returns a Mutable copy of the interval's extent. The returned Mutable
+// does not retain the end point flags and so describes a closed range.
+func (i *FlaggedInterval) NewMutable() Mutable {
+	return &closedRange{start: i.Low, end: i.High}
+}
+
+// closedRange is a Mutable describing a closed range.
+type closedRange struct {
+	start, end Comparable
+}
+
+func (r *closedRange) Start() Comparable     { return r.start }
+func (r *closedRange) End() Comparable       { return r.end }
+func (r *closedRange) SetStart(c Comparable) { r.start = c }
+func (r *closedRange) SetEnd(c Comparable)   { r.end = c }
@@ -5,6 +5,8 @@
 package interval
 
 import (
+	"sort"
+
 	"github.com/biogo/store/llrb"
 )
 
@@ -184,6 +186,53 @@ func (t *IntTree) Get(q IntOverlapper) (o []IntInterface) {
 	return
 }
 
+// GetSorted returns a slice of IntInterfaces that overlap q in the IntTree, treating both
+// q and the stored intervals as half-open, sorted by start and then by ID. Since the IntTree
+// is ordered by start and ID and is traversed in order, no additional sorting is performed;
+// GetSorted is equivalent to Get with a half-open IntOverlapper, but makes the ordering of
+// the result explicit. The ordering uses the ranges of intervals as they were when inserted.
+func (t *IntTree) GetSorted(q IntRange) []IntInterface {
+	return t.Get(intRange(q))
+}
+
+// GetBatch returns, for each range in qs, a slice of IntInterfaces that overlap the range,
+// treating both the ranges and the stored intervals as half-open. The ith element of the
+// returned slice holds the result for qs[i] in the same order as Get would return them,
+// or nil if there are no overlapping intervals. Queries are performed in order of range
+// start to improve locality, and results share a single backing array.
+func (t *IntTree) GetBatch(qs []IntRange) [][]IntInterface {
+	o := make([][]IntInterface, len(qs))
+	if t.Root == nil {
+		return o
+	}
+	idx := make([]int, len(qs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return qs[idx[i]].Start < qs[idx[j]].Start })
+
+	var (
+		buf    []IntInterface
+		bounds = make([][2]int, len(qs))
+		q      intRange
+		fn     = func(e IntInterface) (done bool) { buf = append(buf, e); return }
+	)
+	for _, i := range idx {
+		q = intRange(qs[i])
+		start := len(buf)
+		if q.Overlap(t.Root.Range) {
+			t.Root.doMatch(fn, &q)
+		}
+		bounds[i] = [2]int{start, len(buf)}
+	}
+	for i, b := range bounds {
+		if b[0] != b[1] {
+			o[i] = buf[b[0]:b[1]:b[1]]
+		}
+	}
+	return o
+}
+
 // AdjustRanges fixes range fields for all IntNodes in the IntTree. This must be called
 // before Get or DoMatching* is used if fast insertion or deletion has been performed.
 func (t *IntTree) AdjustRanges() {
@@ -203,6 +252,30 @@ func (n *IntNode) adjustRanges() {
 	n.adjustRange()
 }
 
+// Shift translates every interval held by the IntTree by delta. Each stored IntInterface
+// is passed to shift with delta, and shift must alter the value in place so that its Range
+// method returns the previous range translated by delta. The Interval and Range fields of
+// each IntNode are then updated from the stored values. The structure of the tree is
+// unchanged since the relative order of the intervals is preserved.
+func (t *IntTree) Shift(delta int, shift func(e IntInterface, delta int)) {
+	if t.Root == nil {
+		return
+	}
+	t.Root.shift(delta, shift)
+}
+
+func (n *IntNode) shift(delta int, shift func(IntInterface, int)) {
+	if n.Left != nil {
+		n.Left.shift(delta, shift)
+	}
+	if n.Right != nil {
+		n.Right.shift(delta, shift)
+	}
+	shift(n.Elem, delta)
+	n.Interval = n.Elem.Range()
+	n.adjustRange()
+}
+
 // Insert inserts the IntInterface e into the IntTree. Insertions may replace
 // existing stored intervals.
 func (t *IntTree) Insert(e IntInterface, fast bool) (err error) {
@@ -234,7 +307,7 @@ func (n *IntNode) insert(e IntInterface, r IntRange, id uintptr, fast bool) (roo
 		}
 	}
 
-	switch c := r.Start - n.Interval.Start; {
+	switch c := llrb.CompareInt(r.Start, n.Interval.Start); {
 	case c == 0:
 		switch {
 		case id == n.Elem.ID():
@@ -298,7 +371,7 @@ func (n *IntNode) deleteMin(fast bool) (root *IntNode, d int) {
 	}
 	n.Left, d = n.Left.deleteMin(fast)
 	if n.Left == nil {
-		n.Range.Start = n.Elem.Range().Start
+		n.Range.Start = n.Interval.Start
 	}
 
 	root = n.fixUp(fast)
@@ -332,7 +405,7 @@ func (n *IntNode) deleteMax(fast bool) (root *IntNode, d int) {
 	}
 	n.Right, d = n.Right.deleteMax(fast)
 	if n.Right == nil {
-		n.Range.End = n.Elem.Range().End
+		n.Range.End = n.Interval.End
 	}
 
 	root = n.fixUp(fast)
@@ -358,8 +431,29 @@ func (t *IntTree) Delete(e IntInterface, fast bool) (err error) {
 	return
 }
 
+// RemoveIf deletes all intervals in the IntTree for which pred returns true and returns
+// the number of intervals deleted. Range fields of the IntTree are fixed after deletion.
+func (t *IntTree) RemoveIf(pred func(IntInterface) bool) int {
+	var del []IntInterface
+	t.Do(func(e IntInterface) (done bool) {
+		if pred(e) {
+			del = append(del, e)
+		}
+		return
+	})
+	if len(del) == 0 {
+		return 0
+	}
+	n := t.Count
+	for _, e := range del {
+		t.Delete(e, true)
+	}
+	t.AdjustRanges()
+	return n - t.Count
+}
+
 func (n *IntNode) delete(m int, id uintptr, fast bool) (root *IntNode, d int) {
-	if p := m - n.Interval.Start; p < 0 || (p == 0 && id < n.Elem.ID()) {
+	if p := llrb.CompareInt(m, n.Interval.Start); p < 0 || (p == 0 && id < n.Elem.ID()) {
 		if n.Left != nil {
 			if n.Left.color() == llrb.Black && n.Left.Left.color() == llrb.Black {
 				n = n.moveRedLeft()
@@ -444,7 +538,7 @@ func (n *IntNode) floor(m int, id uintptr) *IntNode {
 	if n == nil {
 		return nil
 	}
-	switch c := m - n.Interval.Start; {
+	switch c := llrb.CompareInt(m, n.Interval.Start); {
 	case c == 0:
 		switch {
 		case id == n.Elem.ID():
@@ -483,7 +577,7 @@ func (n *IntNode) ceil(m int, id uintptr) *IntNode {
 	if n == nil {
 		return nil
 	}
-	switch c := m - n.Interval.Start; {
+	switch c := llrb.CompareInt(m, n.Interval.Start); {
 	case c == 0:
 		switch {
 		case id == n.Elem.ID():
@@ -537,6 +631,75 @@ func (n *IntNode) do(fn IntOperation) (done bool) {
 	return
 }
 
+// Slice returns all the intervals stored in the tree in the order they are traversed by
+// Do, ascending by start and then by ID.
+func (t *IntTree) Slice() []IntInterface {
+	s := make([]IntInterface, 0, t.Count)
+	t.Do(func(e IntInterface) (done bool) {
+		s = append(s, e)
+		return
+	})
+	return s
+}
+
+// Ranges returns the ranges of all the intervals stored in the tree in the order they
+// are traversed by Do.
+func (t *IntTree) Ranges() []IntRange {
+	r := make([]IntRange, 0, t.Count)
+	t.Do(func(e IntInterface) (done bool) {
+		r = append(r, e.Range())
+		return
+	})
+	return r
+}
+
+// An IntCursor is a pull-based in-order iterator over the intervals stored in an IntTree.
+// An IntCursor is invalidated by any mutation of the IntTree it was obtained from.
+type IntCursor struct {
+	root  *IntNode
+	stack []*IntNode
+}
+
+// Cursor returns an IntCursor positioned at the first interval stored in the tree.
+func (t *IntTree) Cursor() *IntCursor {
+	c := &IntCursor{root: t.Root}
+	c.pushLeft(t.Root)
+	return c
+}
+
+// pushLeft pushes n and its chain of left descendants onto the cursor's stack.
+func (c *IntCursor) pushLeft(n *IntNode) {
+	for ; n != nil; n = n.Left {
+		c.stack = append(c.stack, n)
+	}
+}
+
+// Next returns the next interval in the tree in order of start position and ID, and
+// advances the cursor. If no intervals remain, Next returns false.
+func (c *IntCursor) Next() (IntInterface, bool) {
+	if len(c.stack) == 0 {
+		return nil, false
+	}
+	n := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	c.pushLeft(n.Right)
+	return n.Elem, true
+}
+
+// SeekStart positions the cursor so that the following call to Next returns the first
+// interval in the tree with a start position greater than or equal to min.
+func (c *IntCursor) SeekStart(min int) {
+	c.stack = c.stack[:0]
+	for n := c.root; n != nil; {
+		if n.Interval.Start >= min {
+			c.stack = append(c.stack, n)
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+}
+
 // DoReverse performs fn on all intervals stored in the tree, but in reverse of sort order. A boolean
 // is returned indicating whether the Do traversal was interrupted by an IntOperation returning true.
 // If fn alters stored intervals' end points, future tree operation behaviors are undefined.
@@ -596,6 +759,104 @@ func (n *IntNode) doMatch(fn IntOperation, q IntOverlapper) (done bool) {
 	return
 }
 
+// intRange is an IntOverlapper that overlaps ranges sharing at least one position with it,
+// treating ranges as half-open.
+type intRange IntRange
+
+func (r intRange) Overlap(b IntRange) bool { return b.End > r.Start && b.Start < r.End }
+
+// Density returns the number of stored intervals covering each position in r, with the
+// ith element of the returned slice holding the depth at position r.Start+i. Stored intervals
+// are treated as half-open, covering the positions in [Start, End). If r is empty or inverted,
+// Density returns nil.
+func (t *IntTree) Density(r IntRange) []int {
+	if r.End <= r.Start {
+		return nil
+	}
+	d := make([]int, r.End-r.Start+1)
+	t.DoMatching(func(e IntInterface) (done bool) {
+		er := e.Range()
+		start, end := er.Start, er.End
+		if start < r.Start {
+			start = r.Start
+		}
+		if end > r.End {
+			end = r.End
+		}
+		if start < end {
+			d[start-r.Start]++
+			d[end-r.Start]--
+		}
+		return
+	}, intRange(r))
+	for i := 1; i < len(d); i++ {
+		d[i] += d[i-1]
+	}
+	return d[:len(d)-1]
+}
+
+// BestOverlap returns the stored interval with the greatest intersection with q and the width
+// of that intersection. Stored intervals and q are treated as half-open. Ties are broken in
+// favor of the interval with the lowest ID. If no stored interval overlaps q, ok is returned
+// false.
+func (t *IntTree) BestOverlap(q IntRange) (best IntInterface, width int, ok bool) {
+	t.DoMatching(func(e IntInterface) (done bool) {
+		r := e.Range()
+		start, end := r.Start, r.End
+		if start < q.Start {
+			start = q.Start
+		}
+		if end > q.End {
+			end = q.End
+		}
+		w := end - start
+		if !ok || w > width || (w == width && e.ID() < best.ID()) {
+			best, width, ok = e, w, true
+		}
+		return
+	}, intRange(q))
+	return best, width, ok
+}
+
+// OverlapPairs performs fn on each unordered pair of intervals stored in the tree that overlap
+// according to Overlap. Each pair is visited once, with a sorting before b. A boolean is returned
+// indicating whether the traversal was interrupted by fn returning true. If fn alters stored
+// intervals' end points, future tree operation behaviors are undefined.
+func (t *IntTree) OverlapPairs(fn func(a, b IntInterface) (done bool)) bool {
+	if t.Root == nil {
+		return false
+	}
+	return t.Root.do(func(a IntInterface) (done bool) {
+		r, id := a.Range(), a.ID()
+		return t.DoMatching(func(b IntInterface) (done bool) {
+			if s := b.Range().Start; s < r.Start || (s == r.Start && b.ID() <= id) {
+				return
+			}
+			return fn(a, b)
+		}, a)
+	})
+}
+
+// FlattenWithin returns the ranges covered by intervals stored in the tree, merging intervals
+// separated by no more than gap positions. Stored intervals are treated as half-open, so with a
+// gap of zero only overlapping and abutting intervals are merged. The returned ranges are in
+// ascending order and do not overlap.
+func (t *IntTree) FlattenWithin(gap int) []IntRange {
+	var f []IntRange
+	t.Do(func(e IntInterface) (done bool) {
+		r := e.Range()
+		if n := len(f); n != 0 && r.Start-f[n-1].End <= gap {
+			if r.End > f[n-1].End {
+				f[n-1].End = r.End
+			}
+			return
+		}
+		f = append(f, r)
+		return
+	})
+	return f
+}
+
 // DoMatchReverse performs fn on all intervals stored in the tree that match q according to Overlap,
 // with q.Overlap() used to guide tree traversal, so DoMatching() will out perform Do() with a called
 // conditional function if the condition is based on sort order, but can not be reliably used if
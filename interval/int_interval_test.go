@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"unsafe"
 
 	"gopkg.in/check.v1"
 
+	"github.com/biogo/store/internal/testutil"
 	"github.com/biogo/store/llrb"
 )
 
@@ -361,6 +363,108 @@ func (s *S) TestIntFastDeletion(c *check.C) {
 	c.Check(*t, check.Equals, IntTree{})
 }
 
+func (s *S) TestIntRemoveIf(c *check.C) {
+	const narrow = 8
+	t := &IntTree{}
+	c.Check(t.RemoveIf(func(IntInterface) bool { return true }), check.Equals, 0)
+
+	var want []IntInterface
+	for i := 0; i < 1000; i++ {
+		s := rand.Intn(1000)
+		e := &intOverlap{start: s, end: s + rand.Intn(20) + 1, id: uintptr(i)}
+		t.Insert(e, false)
+		if e.end-e.start >= narrow {
+			want = append(want, e)
+		}
+	}
+	n := t.RemoveIf(func(e IntInterface) bool {
+		r := e.Range()
+		return r.End-r.Start < narrow
+	})
+	c.Check(n, check.Equals, 1000-len(want))
+	c.Check(t.Len(), check.Equals, len(want))
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+	c.Check(t.isRanged(), check.Equals, true)
+
+	var got []IntInterface
+	t.Do(func(e IntInterface) (done bool) {
+		got = append(got, e)
+		return
+	})
+	sort.Slice(want, func(i, j int) bool {
+		a, b := want[i].Range(), want[j].Range()
+		return a.Start < b.Start || (a.Start == b.Start && want[i].ID() < want[j].ID())
+	})
+	c.Check(got, check.DeepEquals, want)
+
+	c.Check(t.RemoveIf(func(IntInterface) bool { return true }), check.Equals, len(want))
+	c.Check(*t, check.Equals, IntTree{})
+}
+
+func (s *S) TestIntExtremeCoordinates(c *check.C) {
+	const (
+		maxInt = int(^uint(0) >> 1)
+		minInt = -maxInt - 1
+		maxID  = ^uintptr(0)
+	)
+	ivs := []*intOverlap{
+		{start: maxInt - 10, end: maxInt, id: 1},
+		{start: minInt, end: minInt + 10, id: 2},
+		{start: 0, end: 10, id: 3},
+		{start: minInt + 5, end: 0, id: 4},
+		{start: maxInt - 20, end: maxInt - 5, id: maxID},
+		{start: maxInt - 20, end: maxInt - 15, id: 0},
+		{start: minInt, end: maxInt, id: maxID - 1},
+		{start: -1, end: 1, id: maxID / 2},
+	}
+	t := &IntTree{}
+	for _, iv := range ivs {
+		c.Assert(t.Insert(iv, false), check.Equals, nil)
+	}
+	c.Check(t.Len(), check.Equals, len(ivs))
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+	c.Check(t.isRanged(), check.Equals, true)
+
+	want := append([]*intOverlap(nil), ivs...)
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].start < want[j].start || (want[i].start == want[j].start && want[i].id < want[j].id)
+	})
+	var got []*intOverlap
+	t.Do(func(e IntInterface) (done bool) {
+		got = append(got, e.(*intOverlap))
+		return
+	})
+	c.Check(got, check.DeepEquals, want)
+
+	for _, iv := range ivs {
+		f, err := t.Floor(iv)
+		c.Check(err, check.Equals, nil)
+		c.Check(f, check.Equals, iv)
+		ce, err := t.Ceil(iv)
+		c.Check(err, check.Equals, nil)
+		c.Check(ce, check.Equals, iv)
+		var found bool
+		for _, e := range t.Get(iv) {
+			found = found || e == IntInterface(iv)
+		}
+		c.Check(found, check.Equals, true, check.Commentf("%v not found", iv))
+	}
+	c.Check(t.Get(&intOverlap{start: maxInt - 1, end: maxInt}), check.HasLen, 2)
+	c.Check(t.Get(&intOverlap{start: minInt, end: minInt + 1}), check.HasLen, 2)
+
+	for i, iv := range ivs {
+		c.Check(t.Delete(iv, false), check.Equals, nil)
+		c.Check(t.Len(), check.Equals, len(ivs)-i-1)
+		c.Check(t.isBST(), check.Equals, true)
+		c.Check(t.isRanged(), check.Equals, true)
+	}
+	c.Check(*t, check.Equals, IntTree{})
+}
+
 func (s *S) TestIntGet(c *check.C) {
 	var (
 		min, max = 0, 1000
@@ -383,6 +487,353 @@ func (s *S) TestIntGet(c *check.C) {
 	}
 }
 
+func (s *S) TestIntShift(c *check.C) {
+	shift := func(e IntInterface, delta int) {
+		iv := e.(*intOverlap)
+		iv.start += delta
+		iv.end += delta
+	}
+	(&IntTree{}).Shift(10, shift)
+
+	t := &IntTree{}
+	var ivs []*intOverlap
+	for i := 0; i < 500; i++ {
+		s := rand.Intn(1000)
+		iv := &intOverlap{start: s, end: s + rand.Intn(50) + 1, id: uintptr(i)}
+		ivs = append(ivs, iv)
+		t.Insert(iv, false)
+	}
+	queries := make([]IntRange, 100)
+	want := make([][]IntInterface, len(queries))
+	for i := range queries {
+		s := rand.Intn(1100) - 50
+		queries[i] = IntRange{s, s + rand.Intn(100) + 1}
+		want[i] = t.Get(&intOverlap{start: queries[i].Start, end: queries[i].End})
+	}
+	// shape describes the structure of the tree by element ID.
+	var shape func(n *IntNode) string
+	shape = func(n *IntNode) string {
+		if n == nil {
+			return ""
+		}
+		return fmt.Sprintf("(%s,%s)%d %v", shape(n.Left), shape(n.Right), n.Elem.ID(), n.color())
+	}
+	before := shape(t.Root)
+
+	for _, delta := range []int{0, 37, -1000, 963} {
+		t.Shift(delta, shift)
+		for i := range queries {
+			queries[i].Start += delta
+			queries[i].End += delta
+			got := t.Get(&intOverlap{start: queries[i].Start, end: queries[i].End})
+			c.Check(got, check.DeepEquals, want[i], check.Commentf("shift %d query %v", delta, queries[i]))
+		}
+		c.Check(shape(t.Root), check.Equals, before)
+		c.Check(t.isRanged(), check.Equals, true)
+	}
+	for _, iv := range ivs[:250] {
+		c.Check(t.Delete(iv, false), check.Equals, nil)
+	}
+	c.Check(t.Len(), check.Equals, 250)
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.isRanged(), check.Equals, true)
+
+	// A shifted tree answers queries in the same way as a tree
+	// built from the shifted intervals.
+	build := func(delta int) *IntTree {
+		t := &IntTree{}
+		for i, r := range [][2]int{{0, 10}, {20, 30}, {5, 25}} {
+			t.Insert(&intOverlap{start: r[0] + delta, end: r[1] + delta, id: uintptr(i)}, false)
+		}
+		return t
+	}
+	got, want100 := build(0), build(100)
+	got.Shift(100, shift)
+	q := IntRange{Start: 95, End: 135}
+	c.Check(got.Density(q), check.DeepEquals, want100.Density(q))
+	gb, gw, gok := got.BestOverlap(q)
+	wb, ww, wok := want100.BestOverlap(q)
+	c.Check(gb, check.DeepEquals, wb)
+	c.Check(gw, check.Equals, ww)
+	c.Check(gok, check.Equals, wok)
+	var gotPairs, wantPairs int
+	got.OverlapPairs(func(_, _ IntInterface) (done bool) { gotPairs++; return })
+	want100.OverlapPairs(func(_, _ IntInterface) (done bool) { wantPairs++; return })
+	c.Check(gotPairs, check.Equals, wantPairs)
+	c.Check(gotPairs, check.Not(check.Equals), 0)
+	c.Check(got.Ranges(), check.DeepEquals, want100.Ranges())
+	c.Check(got.FlattenWithin(0), check.DeepEquals, want100.FlattenWithin(0))
+	c.Check(got.RemoveIf(func(IntInterface) bool { return true }), check.Equals, 3)
+	c.Check(got.Len(), check.Equals, 0)
+}
+
+func (s *S) TestIntGetSorted(c *check.C) {
+	var (
+		ivs []*intOverlap
+		t   = &IntTree{}
+	)
+	for i := 0; i < 500; i++ {
+		s := rand.Intn(100)
+		ivs = append(ivs, &intOverlap{start: s, end: s + rand.Intn(20) + 1, id: uintptr(i)})
+	}
+	for _, i := range rand.Perm(len(ivs)) {
+		t.Insert(ivs[i], false)
+	}
+	for _, q := range []IntRange{{0, 1}, {10, 20}, {50, 51}, {-10, 200}, {119, 130}, {5, 5}} {
+		got := t.GetSorted(q)
+		var n int
+		for _, iv := range ivs {
+			if iv.end > q.Start && iv.start < q.End {
+				n++
+			}
+		}
+		c.Check(len(got), check.Equals, n, check.Commentf("query %v", q))
+		for i := 1; i < len(got); i++ {
+			a, b := got[i-1].Range(), got[i].Range()
+			c.Check(a.Start < b.Start || (a.Start == b.Start && got[i-1].ID() < got[i].ID()), check.Equals, true,
+				check.Commentf("query %v: %v[%d] before %v[%d]", q, a, got[i-1].ID(), b, got[i].ID()))
+		}
+	}
+}
+
+func (s *S) TestIntGetBatch(c *check.C) {
+	t := &IntTree{}
+	qs := []IntRange{{0, 10}, {5, 6}, {-10, 0}, {90, 130}, {50, 50}, {3, 4}, {0, 10}}
+	c.Check(t.GetBatch(qs), check.DeepEquals, make([][]IntInterface, len(qs)))
+	for i := 0; i < 500; i++ {
+		s := rand.Intn(100)
+		t.Insert(&intOverlap{start: s, end: s + rand.Intn(20) + 1, id: uintptr(i)}, false)
+	}
+	for i := 0; i < 100; i++ {
+		s := rand.Intn(140) - 20
+		qs = append(qs, IntRange{s, s + rand.Intn(10)})
+	}
+	got := t.GetBatch(qs)
+	c.Assert(len(got), check.Equals, len(qs))
+	for i, q := range qs {
+		c.Check(got[i], check.DeepEquals, t.Get(&intOverlap{start: q.Start, end: q.End}), check.Commentf("query %v", q))
+	}
+}
+
+func (s *S) TestIntOverlapPairs(c *check.C) {
+	var (
+		count, max = 200, 1000
+		length     = 20
+		t          = &IntTree{}
+		ivs        []*intOverlap
+	)
+	for i := 0; i < count; i++ {
+		s := rand.Intn(max)
+		iv := &intOverlap{start: s, end: s + rand.Intn(length), id: uintptr(i)}
+		ivs = append(ivs, iv)
+		t.Insert(iv, false)
+	}
+
+	want := make(map[[2]uintptr]bool)
+	for i, a := range ivs {
+		for _, b := range ivs[i+1:] {
+			if a.Overlap(b.Range()) {
+				p := [2]uintptr{a.id, b.id}
+				if p[0] > p[1] {
+					p[0], p[1] = p[1], p[0]
+				}
+				want[p] = true
+			}
+		}
+	}
+	got := make(map[[2]uintptr]bool)
+	killed := t.OverlapPairs(func(a, b IntInterface) (done bool) {
+		c.Check(a.Range().Start <= b.Range().Start, check.Equals, true)
+		p := [2]uintptr{a.ID(), b.ID()}
+		if p[0] > p[1] {
+			p[0], p[1] = p[1], p[0]
+		}
+		c.Check(got[p], check.Equals, false, check.Commentf("pair %v visited twice", p))
+		got[p] = true
+		return
+	})
+	c.Check(killed, check.Equals, false)
+	c.Check(got, check.DeepEquals, want)
+
+	var n int
+	killed = t.OverlapPairs(func(_, _ IntInterface) (done bool) { n++; return true })
+	c.Check(killed, check.Equals, len(want) != 0)
+	c.Check(n, check.Equals, 1)
+}
+
+func (s *S) TestIntDensity(c *check.C) {
+	t := &IntTree{}
+	c.Check(t.Density(IntRange{0, 4}), check.DeepEquals, []int{0, 0, 0, 0})
+	ivs := []*intOverlap{
+		{0, 5, 0},
+		{2, 8, 1},
+		{3, 4, 2},
+		{3, 3, 3},
+		{6, 12, 4},
+		{10, 11, 5},
+		{-4, 1, 6},
+	}
+	for _, iv := range ivs {
+		t.Insert(iv, false)
+	}
+	for _, r := range []IntRange{{-6, 14}, {0, 1}, {3, 7}, {11, 20}, {-10, -5}} {
+		var want []int
+		for p := r.Start; p < r.End; p++ {
+			var n int
+			for _, iv := range ivs {
+				if iv.start <= p && p < iv.end {
+					n++
+				}
+			}
+			c.Check(len(t.Get(&intOverlap{start: p, end: p + 1})), check.Equals, n)
+			want = append(want, n)
+		}
+		c.Check(t.Density(r), check.DeepEquals, want, check.Commentf("range %v", r))
+	}
+	c.Check(t.Density(IntRange{5, 5}), check.IsNil)
+	c.Check(t.Density(IntRange{5, 1}), check.IsNil)
+}
+
+func (s *S) TestIntBestOverlap(c *check.C) {
+	t := &IntTree{}
+	_, _, ok := t.BestOverlap(IntRange{0, 10})
+	c.Check(ok, check.Equals, false)
+	ivs := []*intOverlap{
+		{0, 5, 0},
+		{2, 8, 1},
+		{4, 20, 2},
+		{9, 12, 3},
+		{14, 17, 4},
+		{30, 40, 5},
+		{35, 38, 6},
+		{30, 33, 7},
+	}
+	for _, iv := range ivs {
+		t.Insert(iv, false)
+	}
+	for _, test := range []struct {
+		q     IntRange
+		id    uintptr
+		width int
+		ok    bool
+	}{
+		{q: IntRange{0, 3}, id: 0, width: 3, ok: true},
+		{q: IntRange{1, 8}, id: 1, width: 6, ok: true},
+		{q: IntRange{6, 18}, id: 2, width: 12, ok: true},
+		{q: IntRange{9, 10}, id: 2, width: 1, ok: true},
+		{q: IntRange{22, 30}},
+		{q: IntRange{20, 34}, id: 5, width: 4, ok: true},
+		{q: IntRange{30, 33}, id: 5, width: 3, ok: true},
+		{q: IntRange{35, 38}, id: 5, width: 3, ok: true},
+	} {
+		got, width, ok := t.BestOverlap(test.q)
+		c.Check(ok, check.Equals, test.ok, check.Commentf("query %v", test.q))
+		if !ok {
+			c.Check(got, check.IsNil)
+			continue
+		}
+		c.Check(got.ID(), check.Equals, test.id, check.Commentf("query %v", test.q))
+		c.Check(width, check.Equals, test.width, check.Commentf("query %v", test.q))
+	}
+}
+
+func (s *S) TestIntFlattenWithin(c *check.C) {
+	t := &IntTree{}
+	c.Check(t.FlattenWithin(0), check.IsNil)
+	for i, iv := range []*intOverlap{
+		{0, 5, 0},
+		{3, 4, 0},
+		{5, 8, 0},
+		{10, 12, 0},
+		{15, 16, 0},
+		{19, 25, 0},
+		{20, 30, 0},
+	} {
+		iv.id = uintptr(i)
+		t.Insert(iv, false)
+	}
+	for _, test := range []struct {
+		gap  int
+		want []IntRange
+	}{
+		{0, []IntRange{{0, 8}, {10, 12}, {15, 16}, {19, 30}}},
+		{1, []IntRange{{0, 8}, {10, 12}, {15, 16}, {19, 30}}},
+		{2, []IntRange{{0, 12}, {15, 16}, {19, 30}}},
+		{3, []IntRange{{0, 30}}},
+	} {
+		c.Check(t.FlattenWithin(test.gap), check.DeepEquals, test.want, check.Commentf("gap %d", test.gap))
+	}
+}
+
+func (s *S) TestIntCursor(c *check.C) {
+	_, ok := (&IntTree{}).Cursor().Next()
+	c.Check(ok, check.Equals, false)
+
+	t := &IntTree{}
+	for i := 0; i < 1000; i++ {
+		s := rand.Intn(500)
+		t.Insert(&intOverlap{start: s, end: s + rand.Intn(10) + 1, id: uintptr(i)}, false)
+	}
+	var want []IntInterface
+	t.Do(func(e IntInterface) (done bool) {
+		want = append(want, e)
+		return
+	})
+	collect := func(cur *IntCursor) (got []IntInterface) {
+		for e, ok := cur.Next(); ok; e, ok = cur.Next() {
+			got = append(got, e)
+		}
+		return got
+	}
+	cur := t.Cursor()
+	c.Check(collect(cur), check.DeepEquals, want)
+	_, ok = cur.Next()
+	c.Check(ok, check.Equals, false)
+
+	for _, min := range []int{-10, 0, 1, 100, 250, 499, 500, 1000} {
+		i := 0
+		for i < len(want) && want[i].Range().Start < min {
+			i++
+		}
+		cur.SeekStart(min)
+		got := collect(cur)
+		if i == len(want) {
+			c.Check(got, check.HasLen, 0, check.Commentf("seek to %d", min))
+		} else {
+			c.Check(got, check.DeepEquals, want[i:], check.Commentf("seek to %d", min))
+		}
+	}
+}
+
+func (s *S) TestIntSlice(c *check.C) {
+	t := &IntTree{}
+	c.Check(t.Slice(), check.HasLen, 0)
+	c.Check(t.Ranges(), check.HasLen, 0)
+
+	for i := 0; i < 1000; i++ {
+		s := rand.Intn(500)
+		t.Insert(&intOverlap{start: s, end: s + rand.Intn(10) + 1, id: uintptr(i)}, false)
+	}
+	var want []IntInterface
+	t.Do(func(e IntInterface) (done bool) {
+		want = append(want, e)
+		return
+	})
+	got := t.Slice()
+	c.Check(got, check.DeepEquals, want)
+	c.Check(got, check.HasLen, t.Len())
+	c.Check(sort.SliceIsSorted(got, func(i, j int) bool {
+		ri, rj := got[i].Range(), got[j].Range()
+		return ri.Start < rj.Start || (ri.Start == rj.Start && got[i].ID() < got[j].ID())
+	}), check.Equals, true)
+
+	ranges := t.Ranges()
+	c.Assert(ranges, check.HasLen, len(want))
+	for i, e := range want {
+		c.Check(ranges[i], check.Equals, e.Range())
+	}
+}
+
 func (s *S) TestIntFloor(c *check.C) {
 	min, max := 0, 1000
 	t := &IntTree{}
@@ -759,6 +1210,38 @@ func BenchmarkIntGet(b *testing.B) {
 	}
 }
 
+func intGetBatchData() (*IntTree, []IntRange) {
+	src := testutil.New(1)
+	t := &IntTree{}
+	for i, iv := range src.Intervals(1e5, 1e6, 100) {
+		t.Insert(&intOverlap{start: iv.Start, end: iv.End, id: uintptr(i)}, true)
+	}
+	t.AdjustRanges()
+	var qs []IntRange
+	for _, iv := range src.Intervals(1e4, 1e6, 1000) {
+		qs = append(qs, IntRange(iv))
+	}
+	return t, qs
+}
+
+func BenchmarkIntGetBatchLoop(b *testing.B) {
+	t, qs := intGetBatchData()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range qs {
+			t.Get(&intOverlap{start: q.Start, end: q.End})
+		}
+	}
+}
+
+func BenchmarkIntGetBatch(b *testing.B) {
+	t, qs := intGetBatchData()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.GetBatch(qs)
+	}
+}
+
 func BenchmarkIntMin(b *testing.B) {
 	b.StopTimer()
 	var (
@@ -7,7 +7,11 @@
 package interval
 
 import (
+	"container/heap"
 	"errors"
+	"fmt"
+	"math"
+	"sort"
 
 	"github.com/biogo/store/llrb"
 )
@@ -24,9 +28,14 @@ func init() {
 	}
 }
 
-// ErrInvertedRange is returned if an interval is used where the start value is greater
-// than the end value.
-var ErrInvertedRange = errors.New("interval: inverted range")
+var (
+	// ErrInvertedRange is returned if an interval is used where the start value is greater
+	// than the end value.
+	ErrInvertedRange = errors.New("interval: inverted range")
+
+	// ErrNotInterface is returned if a Mutable that is required to satisfy Interface does not.
+	ErrNotInterface = errors.New("interval: mutable is not an Interface")
+)
 
 // An Overlapper can determine whether it overlaps a range.
 type Overlapper interface {
@@ -216,6 +225,17 @@ func (t *Tree) Len() int {
 	return t.Count
 }
 
+// Extent returns the minimum start and maximum end of the intervals stored in the Tree,
+// taken from the range held by the root Node. If the Tree is empty, ok is false. The
+// returned values are only valid if the ranges are current, so AdjustRanges must be
+// called before Extent if fast insertion or deletion has been performed.
+func (t *Tree) Extent() (min, max Comparable, ok bool) {
+	if t.Root == nil {
+		return nil, nil, false
+	}
+	return t.Root.Range.Start(), t.Root.Range.End(), true
+}
+
 // Get returns a slice of Interfaces that overlap q in the Tree according
 // to q.Overlap().
 func (t *Tree) Get(q Overlapper) (o []Interface) {
@@ -225,6 +245,47 @@ func (t *Tree) Get(q Overlapper) (o []Interface) {
 	return
 }
 
+// An OverlapError is returned by ValidateOverlap when a query finds fewer intervals
+// using the tree's pruned traversal than by a linear scan of the tree.
+type OverlapError struct {
+	Query  Overlapper  // The query that exposed the inconsistency.
+	Missed []Interface // Intervals overlapping Query that were not returned by Get.
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("interval: query %v: %d overlapping intervals missed by pruned traversal", e.Query, len(e.Missed))
+}
+
+// ValidateOverlap checks that the Overlap method of each sample query is consistent with
+// the range pruning used by the Tree, by comparing the result of Get with a linear scan of
+// all stored intervals using Overlap. If an interval overlapped by a sample is not returned
+// by Get, an *OverlapError describing the first failing sample is returned. ValidateOverlap
+// is intended as a debugging aid for Overlapper implementations.
+func (t *Tree) ValidateOverlap(samples []Overlapper) error {
+	for _, q := range samples {
+		found := make(map[uintptr]int)
+		for _, e := range t.Get(q) {
+			found[e.ID()]++
+		}
+		var missed []Interface
+		t.Do(func(e Interface) (done bool) {
+			if !q.Overlap(e) {
+				return
+			}
+			if found[e.ID()] == 0 {
+				missed = append(missed, e)
+			} else {
+				found[e.ID()]--
+			}
+			return
+		})
+		if missed != nil {
+			return &OverlapError{Query: q, Missed: missed}
+		}
+	}
+	return nil
+}
+
 // AdjustRanges fixes range fields for all Nodes in the Tree. This must be called
 // before Get or DoMatching* is used if fast insertion or deletion has been performed.
 func (t *Tree) AdjustRanges() {
@@ -247,25 +308,33 @@ func (n *Node) adjustRanges() {
 // Insert inserts the Interface e into the Tree. Insertions may replace
 // existing stored intervals.
 func (t *Tree) Insert(e Interface, fast bool) (err error) {
+	_, _, err = t.InsertReplacing(e, fast)
+	return
+}
+
+// InsertReplacing inserts the Interface e into the Tree. If an interval with the same
+// start and ID as e is already stored, it is replaced by e and returned as old with
+// replaced set to true.
+func (t *Tree) InsertReplacing(e Interface, fast bool) (old Interface, replaced bool, err error) {
 	if e.Start().Compare(e.End()) > 0 {
-		return ErrInvertedRange
+		return nil, false, ErrInvertedRange
 	}
 	var d int
-	t.Root, d = t.Root.insert(e, e.Start(), e.ID(), fast)
+	t.Root, old, d = t.Root.insert(e, e.Start(), e.ID(), fast)
 	t.Count += d
 	t.Root.Color = llrb.Black
-	return
+	return old, d == 0, nil
 }
 
-func (n *Node) insert(e Interface, min Comparable, id uintptr, fast bool) (root *Node, d int) {
+func (n *Node) insert(e Interface, min Comparable, id uintptr, fast bool) (root *Node, old Interface, d int) {
 	if n == nil {
-		return &Node{Elem: e, Range: e.NewMutable()}, 1
+		return &Node{Elem: e, Range: e.NewMutable()}, nil, 1
 	} else if n.Elem == nil {
 		n.Elem = e
 		if !fast {
 			n.adjustRange()
 		}
-		return n, 1
+		return n, nil, 1
 	}
 
 	if Mode == TD234 {
@@ -278,19 +347,20 @@ func (n *Node) insert(e Interface, min Comparable, id uintptr, fast bool) (root
 	case c == 0:
 		switch {
 		case id == n.Elem.ID():
+			old = n.Elem
 			n.Elem = e
 			if !fast {
 				n.Range.SetEnd(e.End())
 			}
 		case id < n.Elem.ID():
-			n.Left, d = n.Left.insert(e, min, id, fast)
+			n.Left, old, d = n.Left.insert(e, min, id, fast)
 		default:
-			n.Right, d = n.Right.insert(e, min, id, fast)
+			n.Right, old, d = n.Right.insert(e, min, id, fast)
 		}
 	case c < 0:
-		n.Left, d = n.Left.insert(e, min, id, fast)
+		n.Left, old, d = n.Left.insert(e, min, id, fast)
 	default:
-		n.Right, d = n.Right.insert(e, min, id, fast)
+		n.Right, old, d = n.Right.insert(e, min, id, fast)
 	}
 
 	if n.Right.color() == llrb.Red && n.Left.color() == llrb.Black {
@@ -314,6 +384,176 @@ func (n *Node) insert(e Interface, min Comparable, id uintptr, fast bool) (root
 	return
 }
 
+// CloneMapped returns a new Tree holding copies of the intervals stored in t with start and
+// end values transformed by mapMin and mapMax respectively. Copies are made by calling
+// NewMutable on each stored interval and setting the transformed end points, so the Mutable
+// returned by NewMutable must also satisfy Interface and retain the ID of the original
+// interval; if it does not, ErrNotInterface is returned. If the transformation results in
+// an inverted interval, ErrInvertedRange is returned.
+func (t *Tree) CloneMapped(mapMin, mapMax func(Comparable) Comparable) (*Tree, error) {
+	var (
+		c   = &Tree{}
+		err error
+	)
+	t.Do(func(e Interface) (done bool) {
+		m := e.NewMutable()
+		m.SetStart(mapMin(e.Start()))
+		m.SetEnd(mapMax(e.End()))
+		ce, ok := m.(Interface)
+		if !ok {
+			err = ErrNotInterface
+			return true
+		}
+		err = c.Insert(ce, true)
+		return err != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.AdjustRanges()
+	return c, nil
+}
+
+// Subtree returns a new Tree holding the intervals stored in t that overlap q according to
+// q.Overlap(). The intervals are shared between t and the returned Tree, so alterations to
+// their end points must be followed by calls to AdjustRanges on both trees.
+func (t *Tree) Subtree(q Overlapper) *Tree {
+	s := &Tree{}
+	for _, e := range t.Get(q) {
+		// Stored intervals are known not to be inverted.
+		s.Insert(e, true)
+	}
+	s.AdjustRanges()
+	return s
+}
+
+// MergeOverlapping returns the intervals stored in the tree that overlap q according to
+// q.Overlap(), and the extent of their union, from min, the least start, to max, the greatest
+// end. The tree is not altered. If no stored interval overlaps q, min and max are nil.
+func (t *Tree) MergeOverlapping(q Overlapper) (min, max Comparable, members []Interface) {
+	t.DoMatching(func(e Interface) (done bool) {
+		if members == nil {
+			min = e.Start()
+			max = e.End()
+		} else if end := e.End(); end.Compare(max) > 0 {
+			max = end
+		}
+		members = append(members, e)
+		return
+	}, q)
+	return min, max, members
+}
+
+// GrowOverlap expands acc, using its SetStart and SetEnd methods, to cover every interval
+// stored in the tree that overlaps q according to q.Overlap(), returning whether acc was
+// expanded. The tree is not altered.
+func (t *Tree) GrowOverlap(acc Mutable, q Overlapper) (grew bool) {
+	t.DoMatching(func(e Interface) (done bool) {
+		if start := e.Start(); start.Compare(acc.Start()) < 0 {
+			acc.SetStart(start)
+			grew = true
+		}
+		if end := e.End(); end.Compare(acc.End()) > 0 {
+			acc.SetEnd(end)
+			grew = true
+		}
+		return
+	}, q)
+	return grew
+}
+
+// CountStartRange returns the number of intervals stored in the tree with a start in the
+// range [from, to). The count is obtained by descending the tree guided by interval starts
+// without collecting the intervals. If to is less than from CountStartRange will panic.
+func (t *Tree) CountStartRange(from, to Comparable) int {
+	if from.Compare(to) > 0 {
+		panic("interval: inverted range")
+	}
+	if t.Root == nil {
+		return 0
+	}
+	return t.Root.countStartRange(from, to)
+}
+
+func (n *Node) countStartRange(from, to Comparable) (c int) {
+	start := n.Elem.Start()
+	lc, hc := from.Compare(start), to.Compare(start)
+	if lc <= 0 {
+		if n.Left != nil {
+			c += n.Left.countStartRange(from, to)
+		}
+		if hc > 0 {
+			c++
+		}
+	}
+	if hc > 0 && n.Right != nil {
+		c += n.Right.countStartRange(from, to)
+	}
+	return c
+}
+
+// Nearest returns the interval stored in the tree that is closest to the point p, and the
+// distance between them. The distance between p and an interval is zero if p is within
+// [Start, End] of the interval, and otherwise is the distance from p to the nearer end of the
+// interval as given by dist, which must return the non-negative distance between a and b. The
+// search is made best-first, guided by the range extents held by Nodes. If the tree is empty,
+// Nearest returns nil and positive infinity.
+func (t *Tree) Nearest(p Comparable, dist func(a, b Comparable) float64) (Interface, float64) {
+	if t.Root == nil {
+		return nil, math.Inf(1)
+	}
+	var (
+		best Interface
+		bd   = math.Inf(1)
+		q    = nearestQueue{{t.Root, rangeDist(p, t.Root.Range, dist)}}
+	)
+	for len(q) != 0 {
+		nd := heap.Pop(&q).(nodeDist)
+		if nd.dist >= bd {
+			break
+		}
+		n := nd.node
+		if d := rangeDist(p, n.Elem, dist); d < bd {
+			best, bd = n.Elem, d
+		}
+		for _, c := range [...]*Node{n.Left, n.Right} {
+			if c == nil {
+				continue
+			}
+			if d := rangeDist(p, c.Range, dist); d < bd {
+				heap.Push(&q, nodeDist{c, d})
+			}
+		}
+	}
+	return best, bd
+}
+
+// rangeDist returns the distance between p and r.
+func rangeDist(p Comparable, r Range, dist func(a, b Comparable) float64) float64 {
+	switch {
+	case p.Compare(r.Start()) < 0:
+		return dist(p, r.Start())
+	case p.Compare(r.End()) > 0:
+		return dist(p, r.End())
+	}
+	return 0
+}
+
+// nodeDist is a Node and a lower bound of the distance to the intervals it holds.
+type nodeDist struct {
+	node *Node
+	dist float64
+}
+
+// nearestQueue is a min heap of nodeDist sorted on dist.
+type nearestQueue []nodeDist
+
+func (q nearestQueue) Len() int              { return len(q) }
+func (q nearestQueue) Less(i, j int) bool    { return q[i].dist < q[j].dist }
+func (q nearestQueue) Swap(i, j int)         { q[i], q[j] = q[j], q[i] }
+func (q *nearestQueue) Push(x interface{})   { *q = append(*q, x.(nodeDist)) }
+func (q *nearestQueue) Pop() (i interface{}) { i, *q = (*q)[len(*q)-1], (*q)[:len(*q)-1]; return i }
+
 // DeleteMin deletes the left-most interval.
 func (t *Tree) DeleteMin(fast bool) {
 	if t.Root == nil {
@@ -379,6 +619,30 @@ func (n *Node) deleteMax(fast bool) (root *Node, d int) {
 	return
 }
 
+// PopMin deletes the left-most interval from the Tree and returns it. If the Tree is
+// empty, PopMin returns false. Node ranges are maintained, so AdjustRanges need not be
+// called after PopMin.
+func (t *Tree) PopMin() (Interface, bool) {
+	if t.Root == nil {
+		return nil, false
+	}
+	e := t.Root.min().Elem
+	t.DeleteMin(false)
+	return e, true
+}
+
+// PopMax deletes the right-most interval from the Tree and returns it. If the Tree is
+// empty, PopMax returns false. Node ranges are maintained, so AdjustRanges need not be
+// called after PopMax.
+func (t *Tree) PopMax() (Interface, bool) {
+	if t.Root == nil {
+		return nil, false
+	}
+	e := t.Root.max().Elem
+	t.DeleteMax(false)
+	return e, true
+}
+
 // Delete deletes the element e if it exists in the Tree.
 func (t *Tree) Delete(e Interface, fast bool) (err error) {
 	if e.Start().Compare(e.End()) > 0 {
@@ -542,6 +806,46 @@ func (n *Node) ceil(m Comparable, id uintptr) *Node {
 	return n
 }
 
+// Lower returns the largest value strictly less than the query q according to
+// q.Start().Compare(), with ties broken by comparison of ID() values. If no such value
+// is stored in the tree, Lower returns false.
+func (t *Tree) Lower(q Interface) (Interface, bool) {
+	m, id := q.Start(), q.ID()
+	var best *Node
+	for n := t.Root; n != nil; {
+		if c := m.Compare(n.Elem.Start()); c > 0 || (c == 0 && id > n.Elem.ID()) {
+			best = n
+			n = n.Right
+		} else {
+			n = n.Left
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.Elem, true
+}
+
+// Higher returns the smallest value strictly greater than the query q according to
+// q.Start().Compare(), with ties broken by comparison of ID() values. If no such value
+// is stored in the tree, Higher returns false.
+func (t *Tree) Higher(q Interface) (Interface, bool) {
+	m, id := q.Start(), q.ID()
+	var best *Node
+	for n := t.Root; n != nil; {
+		if c := m.Compare(n.Elem.Start()); c < 0 || (c == 0 && id < n.Elem.ID()) {
+			best = n
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best.Elem, true
+}
+
 // An Operation is a function that operates on an Interface. If done is returned true, the
 // Operation is indicating that no further work needs to be done and so the Do function should
 // traverse no further.
@@ -574,6 +878,147 @@ func (n *Node) do(fn Operation) (done bool) {
 	return
 }
 
+// Layers returns the intervals stored in the tree partitioned into layers such that no
+// two intervals in a layer overlap according to their Overlap methods. Intervals are
+// considered in sort order and each is placed in the lowest-numbered layer in which it
+// overlaps no already placed interval, so for intervals on a line the number of layers
+// is the maximum number of intervals overlapping at any point. Within each layer,
+// intervals are in sort order.
+func (t *Tree) Layers() [][]Interface {
+	var layers [][]Interface
+	t.Do(func(e Interface) (done bool) {
+		for i, l := range layers {
+			// The last interval placed in a layer has the greatest end in the layer.
+			if !e.Overlap(l[len(l)-1]) {
+				layers[i] = append(l, e)
+				return
+			}
+		}
+		layers = append(layers, []Interface{e})
+		return
+	})
+	return layers
+}
+
+// BatchOverlap returns, for each query in queries, the intervals stored in the tree that
+// overlap the query according to its Overlap method, in the same order as Get would return
+// them. The ith element of the returned slice holds the result for queries[i]. Queries that
+// are Ranges are sorted by start and answered in a single sweep over the stored intervals
+// in sort order, so their Overlap methods must not report overlap with intervals that end
+// before the query starts or start after it ends. Other queries are answered using Get.
+func (t *Tree) BatchOverlap(queries []Overlapper) [][]Interface {
+	o := make([][]Interface, len(queries))
+	if t.Root == nil {
+		return o
+	}
+
+	var idx []int
+	for i, q := range queries {
+		if _, ok := q.(Range); ok {
+			idx = append(idx, i)
+		} else {
+			o[i] = t.Get(q)
+		}
+	}
+	if len(idx) == 0 {
+		return o
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return queries[idx[i]].(Range).Start().Compare(queries[idx[j]].(Range).Start()) < 0
+	})
+
+	ivs := make([]Interface, 0, t.Count)
+	t.Root.do(func(e Interface) (done bool) {
+		ivs = append(ivs, e)
+		return
+	})
+
+	// active holds the intervals starting before the current query's start
+	// that may still overlap it, in sort order.
+	var (
+		active []Interface
+		next   int
+	)
+	for _, i := range idx {
+		q := queries[i]
+		r := q.(Range)
+		for ; next < len(ivs) && ivs[next].Start().Compare(r.Start()) < 0; next++ {
+			active = append(active, ivs[next])
+		}
+		live := active[:0]
+		for _, e := range active {
+			if e.End().Compare(r.Start()) >= 0 {
+				live = append(live, e)
+				if q.Overlap(e) {
+					o[i] = append(o[i], e)
+				}
+			}
+		}
+		active = live
+		for _, e := range ivs[next:] {
+			if e.Start().Compare(r.End()) > 0 {
+				break
+			}
+			if q.Overlap(e) {
+				o[i] = append(o[i], e)
+			}
+		}
+	}
+	return o
+}
+
+// DoWithDepth performs fn on all intervals stored in the tree in sort order, passing the
+// depth of the node holding each interval, with the root at depth zero. A boolean is returned
+// indicating whether the traversal was interrupted by fn returning true. If fn alters stored
+// intervals' sort relationships, future tree operation behaviors are undefined.
+func (t *Tree) DoWithDepth(fn func(e Interface, depth int) (done bool)) bool {
+	if t.Root == nil {
+		return false
+	}
+	return t.Root.doWithDepth(fn, 0)
+}
+
+func (n *Node) doWithDepth(fn func(Interface, int) bool, depth int) (done bool) {
+	if n.Left != nil {
+		done = n.Left.doWithDepth(fn, depth+1)
+		if done {
+			return
+		}
+	}
+	done = fn(n.Elem, depth)
+	if done {
+		return
+	}
+	if n.Right != nil {
+		done = n.Right.doWithDepth(fn, depth+1)
+	}
+	return
+}
+
+// DoSorted performs fn on all intervals stored in the tree in the order specified by by, which
+// must return a negative value if a sorts before b, a positive value if a sorts after b and zero
+// otherwise. Intervals that by considers equal are visited in tree order. The intervals are
+// collected before fn is called, so the visitation order is independent of tree structure. A
+// boolean is returned indicating whether the traversal was interrupted by an Operation returning
+// true.
+func (t *Tree) DoSorted(fn Operation, by func(a, b Interface) int) bool {
+	if t.Root == nil {
+		return false
+	}
+	e := make([]Interface, 0, t.Count)
+	t.Root.do(func(iv Interface) (done bool) {
+		e = append(e, iv)
+		return
+	})
+	sort.SliceStable(e, func(i, j int) bool { return by(e[i], e[j]) < 0 })
+	for _, iv := range e {
+		if fn(iv) {
+			return true
+		}
+	}
+	return false
+}
+
 // DoReverse performs fn on all intervals stored in the tree, but in reverse of sort order. A boolean
 // is returned indicating whether the Do traversal was interrupted by an Operation returning true.
 // If fn alters stored intervals' sort relationships, future tree operation behaviors are undefined.
@@ -7,8 +7,10 @@ package interval
 import (
 	"flag"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"unsafe"
@@ -406,6 +408,37 @@ func (s *S) TestInsertion(c *check.C) {
 	c.Check(t.Max().Start(), check.DeepEquals, max)
 }
 
+func (s *S) TestInsertReplacing(c *check.C) {
+	t := &Tree{}
+	for i := compInt(0); i < 100; i++ {
+		old, replaced, err := t.InsertReplacing(&overlap{start: i, end: i + 1, id: uintptr(i)}, false)
+		c.Check(err, check.Equals, nil)
+		c.Check(old, check.Equals, nil)
+		c.Check(replaced, check.Equals, false)
+	}
+	prev := t.Get(&overlap{start: 50, end: 51})
+	c.Assert(prev, check.HasLen, 1)
+
+	e := &overlap{start: 50, end: 200, id: 50}
+	old, replaced, err := t.InsertReplacing(e, false)
+	c.Check(err, check.Equals, nil)
+	c.Check(replaced, check.Equals, true)
+	c.Check(old, check.Equals, prev[0])
+	c.Check(t.Len(), check.Equals, 100)
+	c.Check(t.isRanged(), check.Equals, true)
+	c.Check(t.Get(&overlap{start: 150, end: 151}), check.DeepEquals, []Interface{e})
+
+	old, replaced, err = t.InsertReplacing(&overlap{start: 50, end: 60, id: 1000}, false)
+	c.Check(err, check.Equals, nil)
+	c.Check(old, check.Equals, nil)
+	c.Check(replaced, check.Equals, false)
+	c.Check(t.Len(), check.Equals, 101)
+
+	_, _, err = t.InsertReplacing(&overlap{start: 10, end: 5}, false)
+	c.Check(err, check.Equals, ErrInvertedRange)
+	c.Check(t.Len(), check.Equals, 101)
+}
+
 func (s *S) TestFastInsertion(c *check.C) {
 	var (
 		min, max = compInt(0), compInt(1000)
@@ -517,6 +550,546 @@ func (s *S) TestGet(c *check.C) {
 	}
 }
 
+// overlapOnly is an Overlapper that is not a Range.
+type overlapOnly struct{ *overlap }
+
+func (o overlapOnly) Overlap(b Range) bool { return o.overlap.Overlap(b) }
+
+func (s *S) TestBatchOverlap(c *check.C) {
+	c.Check((&Tree{}).BatchOverlap([]Overlapper{&overlap{start: 0, end: 1}}), check.DeepEquals, [][]Interface{nil})
+
+	// Intervals from the DoMatching Merge example.
+	example := &Tree{}
+	for i, iv := range []*overlap{
+		{start: 0, end: 2},
+		{start: 2, end: 4},
+		{start: 1, end: 6},
+		{start: 3, end: 4},
+		{start: 1, end: 3},
+		{start: 4, end: 6},
+		{start: 5, end: 8},
+		{start: 6, end: 8},
+		{start: 5, end: 7},
+		{start: 8, end: 9},
+	} {
+		iv.id = uintptr(i)
+		example.Insert(iv, false)
+	}
+	random := &Tree{}
+	for i := 0; i < 500; i++ {
+		s := compInt(rand.Intn(1000))
+		random.Insert(&overlap{start: s, end: s + compInt(rand.Intn(50)) + 1, id: uintptr(i)}, false)
+	}
+
+	for _, test := range []struct {
+		t     *Tree
+		limit int
+	}{{example, 12}, {random, 1100}} {
+		var queries []Overlapper
+		for i := 0; i < 200; i++ {
+			s := compInt(rand.Intn(test.limit) - 2)
+			e := s + compInt(rand.Intn(test.limit/5)+1)
+			switch i % 3 {
+			case 0:
+				queries = append(queries, &overlap{start: s, end: e})
+			case 1:
+				queries = append(queries, FlaggedRange{Low: s, High: e})
+			case 2:
+				queries = append(queries, overlapOnly{&overlap{start: s, end: e}})
+			}
+		}
+		got := test.t.BatchOverlap(queries)
+		c.Assert(got, check.HasLen, len(queries))
+		for i, q := range queries {
+			c.Check(got[i], check.DeepEquals, test.t.Get(q), check.Commentf("query %d %v", i, q))
+		}
+	}
+}
+
+func (s *S) TestDoSorted(c *check.C) {
+	byMaxDesc := func(a, b Interface) int { return b.End().Compare(a.End()) }
+	c.Check((&Tree{}).DoSorted(func(Interface) bool { return true }, byMaxDesc), check.Equals, false)
+
+	t := &Tree{}
+	for i := 0; i < 100; i++ {
+		s := compInt(rand.Intn(100))
+		t.Insert(&overlap{start: s, end: s + compInt(rand.Intn(10)) + 1, id: uintptr(i)}, false)
+	}
+	var inOrder, got []Interface
+	t.Do(func(e Interface) (done bool) {
+		inOrder = append(inOrder, e)
+		return
+	})
+	c.Check(t.DoSorted(func(e Interface) (done bool) {
+		got = append(got, e)
+		return
+	}, byMaxDesc), check.Equals, false)
+	c.Assert(got, check.HasLen, t.Len())
+	for i := 1; i < len(got); i++ {
+		c.Check(got[i-1].End().Compare(got[i].End()) >= 0, check.Equals, true)
+	}
+	// Ties are visited in tree order.
+	pos := make(map[Interface]int)
+	for i, e := range inOrder {
+		pos[e] = i
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1].End().Compare(got[i].End()) == 0 {
+			c.Check(pos[got[i-1]] < pos[got[i]], check.Equals, true)
+		}
+	}
+
+	var n int
+	c.Check(t.DoSorted(func(e Interface) (done bool) {
+		n++
+		return n == 10
+	}, byMaxDesc), check.Equals, true)
+	c.Check(n, check.Equals, 10)
+}
+
+func (s *S) TestFlaggedInterval(c *check.C) {
+	closed := &Tree{}
+	closed.Insert(&FlaggedInterval{FlaggedRange{Low: compInt(0), High: compInt(5)}, 0}, false)
+	closed.Insert(&FlaggedInterval{FlaggedRange{Low: compInt(5), High: compInt(10)}, 1}, false)
+	open := &Tree{}
+	open.Insert(&FlaggedInterval{FlaggedRange{Low: compInt(0), High: compInt(5), LowOpen: true, HighOpen: true}, 0}, false)
+	open.Insert(&FlaggedInterval{FlaggedRange{Low: compInt(5), High: compInt(10), LowOpen: true, HighOpen: true}, 1}, false)
+
+	ids := func(o []Interface) (id []uintptr) {
+		for _, e := range o {
+			id = append(id, e.ID())
+		}
+		return id
+	}
+	for _, t := range []struct {
+		q           FlaggedRange
+		closed      []uintptr
+		open        []uintptr
+		description string
+	}{
+		{FlaggedRange{Low: compInt(5), High: compInt(5)}, []uintptr{0, 1}, nil, "closed point at touch"},
+		{FlaggedRange{Low: compInt(5), High: compInt(5), LowOpen: true}, nil, nil, "empty range"},
+		{FlaggedRange{Low: compInt(4), High: compInt(5)}, []uintptr{0, 1}, []uintptr{0}, "closed query ending at touch"},
+		{FlaggedRange{Low: compInt(4), High: compInt(5), HighOpen: true}, []uintptr{0}, []uintptr{0}, "half-open query ending at touch"},
+		{FlaggedRange{Low: compInt(5), High: compInt(6), LowOpen: true}, []uintptr{1}, []uintptr{1}, "open start at touch"},
+		{FlaggedRange{Low: compInt(10), High: compInt(12)}, []uintptr{1}, nil, "closed query at right end"},
+		{FlaggedRange{Low: compInt(-2), High: compInt(0)}, []uintptr{0}, nil, "closed query at left end"},
+		{FlaggedRange{Low: compInt(-2), High: compInt(12), LowOpen: true, HighOpen: true}, []uintptr{0, 1}, []uintptr{0, 1}, "spanning query"},
+	} {
+		c.Check(ids(closed.Get(t.q)), check.DeepEquals, t.closed, check.Commentf("closed-closed: %s", t.description))
+		c.Check(ids(open.Get(t.q)), check.DeepEquals, t.open, check.Commentf("open-open: %s", t.description))
+	}
+
+	// Check that pruning on flagless node ranges does not lose matches.
+	var (
+		t     = &Tree{}
+		elems []*FlaggedInterval
+	)
+	for i := 0; i < 1000; i++ {
+		s := compInt(rand.Intn(100))
+		e := &FlaggedInterval{FlaggedRange{
+			Low: s, High: s + compInt(rand.Intn(5)),
+			LowOpen: rand.Intn(2) == 0, HighOpen: rand.Intn(2) == 0,
+		}, uintptr(i)}
+		t.Insert(e, false)
+		elems = append(elems, e)
+	}
+	for s := compInt(-1); s <= 105; s++ {
+		for _, q := range []FlaggedRange{
+			{Low: s, High: s},
+			{Low: s, High: s + 1, LowOpen: true},
+			{Low: s, High: s + 2, HighOpen: true},
+		} {
+			want := 0
+			for _, e := range elems {
+				c.Check(q.Overlap(e), check.Equals, e.Overlap(q))
+				if q.Overlap(e) {
+					want++
+				}
+			}
+			c.Check(len(t.Get(q)), check.Equals, want, check.Commentf("query %+v", q))
+		}
+	}
+}
+
+// oddOverlap overlaps ranges as overlap does, and additionally overlaps any range
+// exactly matching extra. This is inconsistent with range pruning.
+type oddOverlap struct {
+	overlap
+	extra overlap
+}
+
+func (o *oddOverlap) Overlap(b Range) bool {
+	bc := b.(*overlap)
+	return o.overlap.Overlap(b) || (bc.start == o.extra.start && bc.end == o.extra.end)
+}
+
+func (s *S) TestValidateOverlap(c *check.C) {
+	t := &Tree{}
+	c.Check(t.ValidateOverlap([]Overlapper{&overlap{start: 0, end: 10}}), check.Equals, nil)
+	for i := compInt(0); i < 1000; i++ {
+		t.Insert(&overlap{start: i, end: i + 1, id: uintptr(i)}, false)
+	}
+	var samples []Overlapper
+	for i := compInt(0); i < 1000; i += 7 {
+		samples = append(samples, &overlap{start: i, end: i + 13})
+	}
+	c.Check(t.ValidateOverlap(samples), check.Equals, nil)
+
+	bad := &oddOverlap{overlap: overlap{start: 0, end: 10}, extra: overlap{start: 500, end: 501}}
+	err := t.ValidateOverlap(append(samples, bad))
+	c.Assert(err, check.FitsTypeOf, &OverlapError{})
+	oe := err.(*OverlapError)
+	c.Check(oe.Query, check.Equals, Overlapper(bad))
+	c.Assert(oe.Missed, check.HasLen, 1)
+	c.Check(oe.Missed[0].ID(), check.Equals, uintptr(500))
+}
+
+func (s *S) TestExtent(c *check.C) {
+	_, _, ok := (&Tree{}).Extent()
+	c.Check(ok, check.Equals, false)
+	for _, fast := range []bool{false, true} {
+		t := &Tree{}
+		var min, max compInt
+		for j := 0; j < 100; j++ {
+			s := compInt(rand.Intn(200))
+			e := s + compInt(rand.Intn(20)) + 1
+			if j == 0 || s < min {
+				min = s
+			}
+			if j == 0 || e > max {
+				max = e
+			}
+			t.Insert(&overlap{start: s, end: e, id: uintptr(j)}, fast)
+		}
+		if fast {
+			t.AdjustRanges()
+		}
+		gotMin, gotMax, ok := t.Extent()
+		c.Check(ok, check.Equals, true)
+		c.Check(gotMin, check.Equals, min, check.Commentf("fast=%t", fast))
+		c.Check(gotMax, check.Equals, max, check.Commentf("fast=%t", fast))
+	}
+}
+
+func (s *S) TestLayers(c *check.C) {
+	c.Check((&Tree{}).Layers(), check.IsNil)
+	for i := 0; i < 20; i++ {
+		t := &Tree{}
+		var depth [220]int
+		for j := 0; j < 100; j++ {
+			s := compInt(rand.Intn(200))
+			e := s + compInt(rand.Intn(20)) + 1
+			t.Insert(&overlap{start: s, end: e, id: uintptr(j)}, false)
+			for p := s; p < e; p++ {
+				depth[p]++
+			}
+		}
+		var maxDepth int
+		for _, d := range depth {
+			if d > maxDepth {
+				maxDepth = d
+			}
+		}
+
+		layers := t.Layers()
+		c.Check(layers, check.HasLen, maxDepth)
+		var n int
+		for _, l := range layers {
+			n += len(l)
+			for j, a := range l {
+				if j != 0 {
+					c.Check(l[j-1].Start().Compare(a.Start()) <= 0, check.Equals, true)
+				}
+				for _, b := range l[j+1:] {
+					c.Check(a.Overlap(b), check.Equals, false, check.Commentf("%v overlaps %v", a, b))
+				}
+			}
+		}
+		c.Check(n, check.Equals, t.Len())
+	}
+}
+
+func (s *S) TestDoWithDepth(c *check.C) {
+	t := &Tree{}
+	c.Check(t.DoWithDepth(func(Interface, int) bool { return false }), check.Equals, false)
+	for _, i := range rand.Perm(100) {
+		t.Insert(&overlap{start: compInt(i), end: compInt(i + 1), id: uintptr(i)}, false)
+	}
+
+	depths := make(map[Interface]int)
+	var last Interface
+	killed := t.DoWithDepth(func(e Interface, depth int) (done bool) {
+		if last != nil {
+			c.Check(e.Start().Compare(last.Start()) > 0, check.Equals, true)
+		}
+		last = e
+		depths[e] = depth
+		return
+	})
+	c.Check(killed, check.Equals, false)
+	c.Check(len(depths), check.Equals, t.Len())
+	c.Check(depths[t.Root.Elem], check.Equals, 0)
+	var follow func(n *Node, depth int)
+	follow = func(n *Node, depth int) {
+		if n == nil {
+			return
+		}
+		c.Check(depths[n.Elem], check.Equals, depth)
+		follow(n.Left, depth+1)
+		follow(n.Right, depth+1)
+	}
+	follow(t.Root, 0)
+
+	var n int
+	killed = t.DoWithDepth(func(Interface, int) (done bool) { n++; return n == 10 })
+	c.Check(killed, check.Equals, true)
+	c.Check(n, check.Equals, 10)
+}
+
+type mutableOnly struct{ *overlap }
+
+func (o mutableOnly) NewMutable() Mutable { return struct{ Mutable }{o.overlap.NewMutable()} }
+
+func (s *S) TestCloneMapped(c *check.C) {
+	const shift = 1000
+	var (
+		count, max = 1000, 1000
+		length     = 10
+		t          = &Tree{}
+	)
+	for i := 0; i < count; i++ {
+		s := compInt(rand.Intn(max))
+		t.Insert(&overlap{start: s, end: s + compInt(rand.Intn(length)) + 1, id: uintptr(i)}, false)
+	}
+	add := func(c Comparable) Comparable { return c.(compInt) + shift }
+	m, err := t.CloneMapped(add, add)
+	c.Assert(err, check.Equals, nil)
+	c.Check(m.Len(), check.Equals, t.Len())
+	c.Check(m.isBST(), check.Equals, true)
+	c.Check(m.is23_234(), check.Equals, true)
+	c.Check(m.isBalanced(), check.Equals, true)
+	c.Check(m.isRanged(), check.Equals, true)
+
+	for s := compInt(-length); s < compInt(max+length); s++ {
+		got := m.Get(&overlap{start: s + shift, end: s + shift + 1})
+		want := t.Get(&overlap{start: s, end: s + 1})
+		c.Assert(len(got), check.Equals, len(want))
+		for i := range want {
+			w, g := want[i].(*overlap), got[i].(*overlap)
+			c.Check(g, check.Not(check.Equals), w)
+			c.Check(*g, check.Equals, overlap{start: w.start + shift, end: w.end + shift, id: w.id})
+		}
+	}
+
+	_, err = t.CloneMapped(add, func(c Comparable) Comparable { return c })
+	c.Check(err, check.Equals, ErrInvertedRange)
+
+	n := &Tree{}
+	n.Insert(mutableOnly{&overlap{start: 1, end: 2}}, false)
+	_, err = n.CloneMapped(add, add)
+	c.Check(err, check.Equals, ErrNotInterface)
+}
+
+func (s *S) TestSubtree(c *check.C) {
+	var (
+		count, max = 1000, 1000
+		length     = 20
+		t          = &Tree{}
+	)
+	for i := 0; i < count; i++ {
+		s := compInt(rand.Intn(max))
+		t.Insert(&overlap{start: s, end: s + compInt(rand.Intn(length)) + 1, id: uintptr(i)}, false)
+	}
+	for _, q := range []*overlap{
+		{start: 100, end: 200},
+		{start: 500, end: 501},
+		{start: -100, end: -50},
+		{start: -100, end: 2000},
+	} {
+		want := t.Get(q)
+		st := t.Subtree(q)
+		c.Check(st.Len(), check.Equals, len(want))
+		c.Check(st.isBST(), check.Equals, true)
+		c.Check(st.is23_234(), check.Equals, true)
+		c.Check(st.isBalanced(), check.Equals, true)
+		c.Check(st.isRanged(), check.Equals, true)
+		c.Check(st.Get(q), check.DeepEquals, want, check.Commentf("query %v", q))
+
+		if inner := (&overlap{start: q.start + 10, end: q.start + 20}); inner.end <= q.end {
+			c.Check(st.Get(inner), check.DeepEquals, t.Get(inner), check.Commentf("query %v", inner))
+		}
+	}
+}
+
+func (s *S) TestCountStartRange(c *check.C) {
+	var (
+		count, max = 1000, 1000
+		length     = 20
+		t          = &Tree{}
+	)
+	c.Check(t.CountStartRange(compInt(0), compInt(10)), check.Equals, 0)
+	for i := 0; i < count; i++ {
+		s := compInt(rand.Intn(max))
+		t.Insert(&overlap{start: s, end: s + compInt(rand.Intn(length)) + 1, id: uintptr(i)}, false)
+	}
+	for _, r := range [][2]compInt{{0, 10}, {100, 101}, {500, 500}, {-100, 2000}, {990, 1010}, {-10, 0}} {
+		var want int
+		t.Do(func(e Interface) (done bool) {
+			if s := e.Start().(compInt); r[0] <= s && s < r[1] {
+				want++
+			}
+			return
+		})
+		c.Check(t.CountStartRange(r[0], r[1]), check.Equals, want, check.Commentf("range %v", r))
+	}
+	c.Check(func() { t.CountStartRange(compInt(10), compInt(0)) }, check.Panics, "interval: inverted range")
+}
+
+func (s *S) TestMergeOverlapping(c *check.C) {
+	t := &Tree{}
+	min, max, members := t.MergeOverlapping(&overlap{start: 0, end: 10})
+	c.Check(min, check.IsNil)
+	c.Check(max, check.IsNil)
+	c.Check(members, check.IsNil)
+
+	// Intervals from the DoMatching Merge example.
+	for i, iv := range []*overlap{
+		{start: 0, end: 2},
+		{start: 2, end: 4},
+		{start: 1, end: 6},
+		{start: 3, end: 4},
+		{start: 1, end: 3},
+		{start: 4, end: 6},
+		{start: 5, end: 8},
+		{start: 6, end: 8},
+		{start: 5, end: 7},
+		{start: 8, end: 9},
+	} {
+		iv.id = uintptr(i)
+		t.Insert(iv, false)
+	}
+	before := t.Root.describeTree(false, true)
+
+	min, max, members = t.MergeOverlapping(&overlap{start: -1, end: 4})
+	c.Check(min, check.Equals, compInt(0))
+	c.Check(max, check.Equals, compInt(6))
+	var got []string
+	for _, e := range members {
+		got = append(got, fmt.Sprintf("%v#%d", e, e.ID()))
+	}
+	c.Check(got, check.DeepEquals, []string{"[0,2)#0", "[1,6)#2", "[1,3)#4", "[2,4)#1", "[3,4)#3"})
+	c.Check(t.Root.describeTree(false, true), check.Equals, before)
+	c.Check(t.Len(), check.Equals, 10)
+
+	min, max, members = t.MergeOverlapping(&overlap{start: 7, end: 8})
+	c.Check(min, check.Equals, compInt(5))
+	c.Check(max, check.Equals, compInt(8))
+	c.Check(members, check.HasLen, 2)
+
+	min, max, members = t.MergeOverlapping(&overlap{start: 9, end: 10})
+	c.Check(min, check.IsNil)
+	c.Check(max, check.IsNil)
+	c.Check(members, check.IsNil)
+}
+
+func (s *S) TestGrowOverlap(c *check.C) {
+	t := &Tree{}
+	acc := &overlap{start: 2, end: 3}
+	c.Check(t.GrowOverlap(acc, acc), check.Equals, false)
+
+	// Intervals from the DoMatching Merge example.
+	for i, iv := range []*overlap{
+		{start: 0, end: 2},
+		{start: 2, end: 4},
+		{start: 1, end: 6},
+		{start: 3, end: 4},
+		{start: 1, end: 3},
+		{start: 4, end: 6},
+		{start: 5, end: 8},
+		{start: 6, end: 8},
+		{start: 5, end: 7},
+		{start: 8, end: 9},
+	} {
+		iv.id = uintptr(i)
+		t.Insert(iv, false)
+	}
+
+	// Grow the region until it is stable.
+	for i, want := range []struct {
+		start, end compInt
+		grew       bool
+	}{
+		{1, 6, true},
+		{0, 8, true},
+		{0, 8, false},
+	} {
+		grew := t.GrowOverlap(acc, &overlap{start: acc.start, end: acc.end})
+		c.Check(grew, check.Equals, want.grew, check.Commentf("step %d", i))
+		c.Check(acc.start, check.Equals, want.start, check.Commentf("step %d", i))
+		c.Check(acc.end, check.Equals, want.end, check.Commentf("step %d", i))
+	}
+	c.Check(t.Len(), check.Equals, 10)
+
+	acc = &overlap{start: 8, end: 9}
+	c.Check(t.GrowOverlap(acc, &overlap{start: 8, end: 9}), check.Equals, false)
+	c.Check(acc.String(), check.Equals, "[8,9)")
+}
+
+func (s *S) TestNearest(c *check.C) {
+	dist := func(a, b Comparable) float64 { return math.Abs(float64(a.(compInt) - b.(compInt))) }
+	t := &Tree{}
+	e, d := t.Nearest(compInt(0), dist)
+	c.Check(e, check.IsNil)
+	c.Check(math.IsInf(d, 1), check.Equals, true)
+
+	for i, iv := range [][2]compInt{{10, 20}, {30, 35}, {50, 100}, {60, 70}} {
+		t.Insert(&overlap{start: iv[0], end: iv[1], id: uintptr(i)}, false)
+	}
+	for _, test := range []struct {
+		p    compInt
+		want []uintptr
+		dist float64
+	}{
+		{15, []uintptr{0}, 0},
+		{10, []uintptr{0}, 0},
+		{20, []uintptr{0}, 0},
+		{21, []uintptr{0}, 1},
+		{29, []uintptr{1}, 1},
+		{25, []uintptr{0, 1}, 5},
+		{65, []uintptr{2, 3}, 0},
+		{-100, []uintptr{0}, 110},
+		{1000, []uintptr{2}, 900},
+	} {
+		e, d := t.Nearest(test.p, dist)
+		c.Check(d, check.Equals, test.dist, check.Commentf("point %d", test.p))
+		var ok bool
+		for _, id := range test.want {
+			ok = ok || e.ID() == id
+		}
+		c.Check(ok, check.Equals, true, check.Commentf("point %d: got %v", test.p, e))
+	}
+
+	t = &Tree{}
+	var ivs []*overlap
+	for i := 0; i < 200; i++ {
+		s := compInt(rand.Intn(10000))
+		iv := &overlap{start: s, end: s + compInt(rand.Intn(20)), id: uintptr(i)}
+		t.Insert(iv, false)
+		ivs = append(ivs, iv)
+	}
+	for i := 0; i < 1000; i++ {
+		p := compInt(rand.Intn(12000) - 1000)
+		want := math.Inf(1)
+		for _, iv := range ivs {
+			want = math.Min(want, rangeDist(p, iv, dist))
+		}
+		e, d := t.Nearest(p, dist)
+		c.Check(d, check.Equals, want, check.Commentf("point %d", p))
+		c.Check(rangeDist(p, e, dist), check.Equals, d)
+	}
+}
+
 func (s *S) TestFloor(c *check.C) {
 	min, max := compInt(0), compInt(1000)
 	t := &Tree{}
@@ -557,6 +1130,48 @@ func (s *S) TestCeil(c *check.C) {
 	c.Check(u, check.DeepEquals, Comparable(nil))
 }
 
+func (s *S) TestLowerHigher(c *check.C) {
+	t := &Tree{}
+	_, ok := t.Lower(&overlap{start: 0, end: 1})
+	c.Check(ok, check.Equals, false)
+	_, ok = t.Higher(&overlap{start: 0, end: 1})
+	c.Check(ok, check.Equals, false)
+
+	for i := 0; i < 500; i++ {
+		s := compInt(rand.Intn(100))
+		t.Insert(&overlap{start: s, end: s + 1, id: uintptr(rand.Intn(1000))}, false)
+	}
+	var sorted []Interface
+	t.Do(func(e Interface) (done bool) {
+		sorted = append(sorted, e)
+		return
+	})
+	for i, e := range sorted {
+		l, ok := t.Lower(e)
+		c.Check(ok, check.Equals, i > 0)
+		if i > 0 {
+			c.Check(l, check.Equals, sorted[i-1], check.Commentf("lower of %v#%d", e, e.ID()))
+		}
+		h, ok := t.Higher(e)
+		c.Check(ok, check.Equals, i < len(sorted)-1)
+		if i < len(sorted)-1 {
+			c.Check(h, check.Equals, sorted[i+1], check.Commentf("higher of %v#%d", e, e.ID()))
+		}
+	}
+
+	// Queries absent from the tree find the neighbouring values.
+	for _, q := range []*overlap{{start: -1}, {start: 50, id: 5000}, {start: 100}} {
+		want, _ := t.Floor(q)
+		l, ok := t.Lower(q)
+		c.Check(ok, check.Equals, want != nil)
+		c.Check(l, check.Equals, want)
+		want, _ = t.Ceil(q)
+		h, ok := t.Higher(q)
+		c.Check(ok, check.Equals, want != nil)
+		c.Check(h, check.Equals, want)
+	}
+}
+
 func (s *S) TestRandomlyInsertedGet(c *check.C) {
 	var (
 		count, max = 1000, 1000
@@ -676,6 +1291,66 @@ func (s *S) TestRandomDeletion(c *check.C) {
 	c.Check(*t, check.DeepEquals, Tree{})
 }
 
+func (s *S) TestPopMinMax(c *check.C) {
+	for _, test := range []struct {
+		name string
+		pop  func(*Tree) (Interface, bool)
+		less func(a, b Interface) bool
+	}{
+		{
+			name: "PopMin",
+			pop:  (*Tree).PopMin,
+			less: func(a, b Interface) bool {
+				c := a.Start().Compare(b.Start())
+				return c < 0 || (c == 0 && a.ID() < b.ID())
+			},
+		},
+		{
+			name: "PopMax",
+			pop:  (*Tree).PopMax,
+			less: func(a, b Interface) bool {
+				c := a.Start().Compare(b.Start())
+				return c > 0 || (c == 0 && a.ID() > b.ID())
+			},
+		},
+	} {
+		t := &Tree{}
+		_, ok := test.pop(t)
+		c.Check(ok, check.Equals, false, check.Commentf("%s on empty tree", test.name))
+
+		var want []Interface
+		for i := 0; i < 200; i++ {
+			s := compInt(rand.Intn(50))
+			iv := &overlap{start: s, end: s + compInt(rand.Intn(10)) + 1, id: uintptr(i)}
+			want = append(want, iv)
+			t.Insert(iv, false)
+		}
+		sort.Slice(want, func(i, j int) bool { return test.less(want[i], want[j]) })
+
+		var got []Interface
+		for {
+			e, ok := test.pop(t)
+			if !ok {
+				break
+			}
+			got = append(got, e)
+			c.Check(t.Len(), check.Equals, len(want)-len(got))
+			if len(got)%20 == 0 {
+				failed := !c.Check(t.isBST(), check.Equals, true)
+				failed = failed || !c.Check(t.is23_234(), check.Equals, true)
+				failed = failed || !c.Check(t.isBalanced(), check.Equals, true)
+				failed = failed || !c.Check(t.isRanged(), check.Equals, true)
+				if failed {
+					c.Fatalf("%s: invalid tree after %d pops", test.name, len(got))
+				}
+			}
+		}
+		c.Check(got, check.DeepEquals, want, check.Commentf("%s", test.name))
+		c.Check(t.Root, check.IsNil)
+		c.Check(t.Len(), check.Equals, 0)
+	}
+}
+
 func (s *S) TestDeleteMinMax(c *check.C) {
 	var (
 		min, max = compInt(0), compInt(10)
@@ -0,0 +1,104 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kdtree
+
+var (
+	_ Interface  = IntPoints{}
+	_ Extender   = IntPoint{}
+	_ Comparable = IntPoint{}
+)
+
+// An IntPoint represents a point in a k-d space with integer coordinates that satisfies the
+// Comparable and Extender interfaces. Differences between coordinates of the same sign are
+// calculated in int, which cannot overflow, and are exact while their magnitude is no greater
+// than 2^53. Differences between coordinates of opposite sign are calculated in float64 to
+// avoid overflow, and so are rounded when either coordinate's magnitude exceeds 2^53.
+// Distances are accumulated in float64.
+type IntPoint []int
+
+func (p IntPoint) Compare(c Comparable, d Dim) float64 {
+	q := c.(IntPoint)
+	return intDiff(p[d], q[d])
+}
+func (p IntPoint) Dims() int { return len(p) }
+func (p IntPoint) Distance(c Comparable) float64 {
+	q := c.(IntPoint)
+	var sum float64
+	for dim, c := range p {
+		d := intDiff(c, q[dim])
+		sum += d * d
+	}
+	return sum
+}
+func (p IntPoint) Extend(b *Bounding) *Bounding {
+	if b == nil {
+		b = &Bounding{append(IntPoint(nil), p...), append(IntPoint(nil), p...)}
+	}
+	min := b[0].(IntPoint)
+	max := b[1].(IntPoint)
+	for d, v := range p {
+		min[d] = intMin(min[d], v)
+		max[d] = intMax(max[d], v)
+	}
+	*b = Bounding{min, max}
+	return b
+}
+
+// An IntPoints is a collection of integer point values that satisfies the Interface.
+type IntPoints []IntPoint
+
+func (p IntPoints) Bounds() *Bounding {
+	if p.Len() == 0 {
+		return nil
+	}
+	min := append(IntPoint(nil), p[0]...)
+	max := append(IntPoint(nil), p[0]...)
+	for _, e := range p[1:] {
+		for d, v := range e {
+			min[d] = intMin(min[d], v)
+			max[d] = intMax(max[d], v)
+		}
+	}
+	return &Bounding{min, max}
+}
+func (p IntPoints) Index(i int) Comparable         { return p[i] }
+func (p IntPoints) Len() int                       { return len(p) }
+func (p IntPoints) Pivot(d Dim) int                { return IntPlane{IntPoints: p, Dim: d}.Pivot() }
+func (p IntPoints) Slice(start, end int) Interface { return p[start:end] }
+
+// An IntPlane is a wrapping type that allows an IntPoints type be pivoted on a dimension.
+type IntPlane struct {
+	Dim
+	IntPoints
+}
+
+func (p IntPlane) Less(i, j int) bool              { return p.IntPoints[i][p.Dim] < p.IntPoints[j][p.Dim] }
+func (p IntPlane) Pivot() int                      { return Partition(p, MedianOfRandoms(p, Randoms)) }
+func (p IntPlane) Slice(start, end int) SortSlicer { p.IntPoints = p.IntPoints[start:end]; return p }
+func (p IntPlane) Swap(i, j int) {
+	p.IntPoints[i], p.IntPoints[j] = p.IntPoints[j], p.IntPoints[i]
+}
+
+// intDiff returns a - b as a float64 without overflow.
+func intDiff(a, b int) float64 {
+	if (a < 0) == (b < 0) {
+		return float64(a - b)
+	}
+	return float64(a) - float64(b)
+}
+
+func intMin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func intMax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,89 @@
+// Copyright ©2012 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kdtree
+
+import (
+	"math"
+	"math/rand"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestIntPoints(c *check.C) {
+	rand.Seed(1)
+	p := make(IntPoints, 1000)
+	for i := range p {
+		p[i] = IntPoint{rand.Intn(1000) - 500, rand.Intn(1000) - 500, rand.Intn(1000) - 500}
+	}
+	for _, bounding := range []bool{false, true} {
+		t := New(append(IntPoints(nil), p...), bounding)
+		c.Check(t.Count, check.Equals, len(p))
+		if bounding {
+			c.Check(t.Root.Bounding, check.DeepEquals, p.Bounds())
+		}
+		for i := 0; i < 100; i++ {
+			q := IntPoint{rand.Intn(1200) - 600, rand.Intn(1200) - 600, rand.Intn(1200) - 600}
+			got, d := t.Nearest(q)
+			ed := q.Distance(p[0])
+			for _, e := range p[1:] {
+				if ed2 := q.Distance(e); ed2 < ed {
+					ed = ed2
+				}
+			}
+			c.Check(d, check.Equals, ed, check.Commentf("Test %d: query %v", i, q))
+			c.Check(q.Distance(got), check.Equals, d)
+		}
+	}
+}
+
+func (s *S) TestIntPointExtend(c *check.C) {
+	b := IntPoint{1, 2}.Extend(nil)
+	b = IntPoint{-3, 5}.Extend(b)
+	b = IntPoint{0, 0}.Extend(b)
+	c.Check(*b, check.DeepEquals, Bounding{IntPoint{-3, 0}, IntPoint{1, 5}})
+}
+
+func (s *S) TestIntPointExtreme(c *check.C) {
+	const (
+		maxInt = int(^uint(0) >> 1)
+		minInt = -maxInt - 1
+	)
+	p := IntPoint{maxInt, minInt}
+	q := IntPoint{minInt, maxInt}
+	c.Check(p.Compare(q, 0) > 0, check.Equals, true)
+	c.Check(p.Compare(q, 1) < 0, check.Equals, true)
+	c.Check(q.Compare(p, 0) < 0, check.Equals, true)
+	c.Check(p.Compare(p, 0), check.Equals, 0.)
+	c.Check(p.Distance(q), check.Equals, 2*math.Pow(math.Pow(2, 64), 2))
+	c.Check(math.IsInf(p.Distance(q), 0), check.Equals, false)
+
+	// Differences between large coordinates of the same sign are exact.
+	for _, pair := range [][2]int{{maxInt, maxInt - 1}, {minInt + 1, minInt}} {
+		a, b := IntPoint{pair[0]}, IntPoint{pair[1]}
+		c.Check(a.Compare(b, 0), check.Equals, 1.)
+		c.Check(b.Compare(a, 0), check.Equals, -1.)
+		c.Check(a.Distance(b), check.Equals, 1.)
+	}
+
+	pts := IntPoints{
+		{maxInt, maxInt},
+		{minInt, minInt},
+		{0, 0},
+		{maxInt, minInt},
+		{minInt, maxInt},
+		{-1, 1},
+	}
+	for _, bounding := range []bool{false, true} {
+		t := New(append(IntPoints(nil), pts...), bounding)
+		c.Check(t.Root.isKDTree(), check.Equals, true)
+		for _, e := range pts {
+			got, d := t.Nearest(e)
+			c.Check(got, check.DeepEquals, e)
+			c.Check(d, check.Equals, 0.)
+		}
+		got, _ := t.Nearest(IntPoint{maxInt - 10, minInt + 10})
+		c.Check(got, check.DeepEquals, IntPoint{maxInt, minInt})
+	}
+}
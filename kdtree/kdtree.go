@@ -77,7 +77,7 @@ func (b *Bounding) Contains(c Comparable) bool {
 		return true
 	}
 	for d := Dim(0); d < Dim(c.Dims()); d++ {
-		if c.Compare(b[0], d) < 0 || c.Compare(b[1], d) > 0 {
+		if b[0].Compare(c, d) > 0 || b[1].Compare(c, d) < 0 {
 			return false
 		}
 	}
@@ -103,21 +103,85 @@ func (n *Node) String() string {
 type Tree struct {
 	Root  *Node
 	Count int
+
+	// ScapegoatAlpha is the balance threshold used by InsertBalanced.
+	// A subtree holding n points is considered unbalanced when its
+	// height exceeds log_{1/ScapegoatAlpha}(n). ScapegoatAlpha must
+	// be zero or in the open interval (0.5, 1); lower values keep the
+	// tree closer to balance at the cost of more frequent rebuilding.
+	// If ScapegoatAlpha is zero, DefaultScapegoatAlpha is used.
+	ScapegoatAlpha float64
+
+	dims int // Number of dimensions of stored points, or zero if not yet known.
 }
 
 // New returns a k-d tree constructed from the values in p. If p is a Bounder and
-// bounding is true, bounds are determined for each node.
+// bounding is true, bounds are determined for each node. New panics if the values
+// in p do not all have the same number of dimensions.
 func New(p Interface, bounding bool) *Tree {
+	var dims int
+	for i := 0; i < p.Len(); i++ {
+		d := p.Index(i).Dims()
+		if i == 0 {
+			dims = d
+		} else if d != dims {
+			panic(dimsMismatch(d, dims))
+		}
+	}
 	if p, ok := p.(bounder); ok && bounding {
 		return &Tree{
 			Root:  buildBounded(p, 0, bounding),
 			Count: p.Len(),
+			dims:  dims,
 		}
 	}
 	return &Tree{
 		Root:  build(p, 0),
 		Count: p.Len(),
+		dims:  dims,
+	}
+}
+
+// dimsMismatch returns the panic message for a point with got dimensions
+// being added to a tree with want dimensions.
+func dimsMismatch(got, want int) string {
+	return fmt.Sprintf("kdtree: dimension mismatch: point has %d dimensions, tree has %d", got, want)
+}
+
+// checkDims panics if c does not have the same number of dimensions as the
+// points stored in t, recording the number of dimensions if not yet known.
+func (t *Tree) checkDims(c Comparable) {
+	if t.Root == nil {
+		t.dims = c.Dims()
+		return
+	}
+	if t.dims == 0 {
+		t.dims = t.Root.Point.Dims()
+	}
+	if d := c.Dims(); d != t.dims {
+		panic(dimsMismatch(d, t.dims))
+	}
+}
+
+// Dims returns the number of dimensions of the points stored in the tree. If the tree
+// is empty, Dims returns zero.
+func (t *Tree) Dims() int {
+	if t.Root == nil {
+		return 0
+	}
+	return t.Root.Point.Dims()
+}
+
+// BuildFrom returns a k-d tree constructed from the coordinates in points, with each
+// element of points held in the tree as a Point. The coordinate slices are retained by
+// the tree but the order of points is not altered. If bounding is true, bounds are
+// determined for each node.
+func BuildFrom(points [][]float64, bounding bool) *Tree {
+	p := make(Points, len(points))
+	for i, c := range points {
+		p[i] = c
 	}
+	return New(p, bounding)
 }
 
 func build(p Interface, plane Dim) *Node {
@@ -159,20 +223,32 @@ func buildBounded(p bounder, plane Dim, bounding bool) *Node {
 
 // Insert adds a point to the tree, updating the bounding volumes if bounding is
 // true, and the tree is empty or the tree already has bounding volumes stored,
-// and c is an Extender. No rebalancing of the tree is performed.
+// and c is an Extender. No rebalancing of the tree is performed. Insert panics if c
+// does not have the same number of dimensions as the points stored in the tree.
 func (t *Tree) Insert(c Comparable, bounding bool) {
+	t.InsertReport(c, bounding)
+}
+
+// InsertReport adds a point to the tree in the same way as Insert and returns whether
+// the tree holds bounding volumes after the insertion. Inserting a point that is not an
+// Extender into a bounded tree discards the tree's bounding volumes, so a false return
+// for a previously bounded tree indicates that the tree must be rebuilt, for example by
+// Balance, to restore them.
+func (t *Tree) InsertReport(c Comparable, bounding bool) (boundsPreserved bool) {
+	t.checkDims(c)
 	t.Count++
 	if t.Root != nil {
 		bounding = t.Root.Bounding != nil
 	}
 	if c, ok := c.(Extender); ok && bounding {
 		t.Root = t.Root.insertBounded(c, 0, bounding)
-		return
+		return t.Root.Bounding != nil
 	} else if !ok && t.Root != nil {
 		// If we are not rebounding, mark the tree as non-bounded.
 		t.Root.Bounding = nil
 	}
 	t.Root = t.Root.insert(c, 0)
+	return false
 }
 
 func (n *Node) insert(c Comparable, d Dim) *Node {
@@ -220,9 +296,194 @@ func (n *Node) insertBounded(c Extender, d Dim, bounding bool) *Node {
 	return n
 }
 
+// DefaultScapegoatAlpha is the balance threshold used by InsertBalanced when the
+// tree's ScapegoatAlpha is zero.
+const DefaultScapegoatAlpha = 0.7
+
+// InsertBalanced adds a point to the tree in the same way as Insert, but if the new point
+// is too deep, rebuilds the smallest subtree on the insertion path that is unbalanced
+// according to the tree's ScapegoatAlpha. This bounds the height of a tree built solely by
+// InsertBalanced to O(log n) without requiring a full rebuild of the tree. InsertBalanced
+// panics under the same conditions as Insert.
+func (t *Tree) InsertBalanced(c Comparable, bounding bool) {
+	t.checkDims(c)
+	var path []*Node
+	for n := t.Root; n != nil; {
+		path = append(path, n)
+		if c.Compare(n.Point, n.Plane) <= 0 {
+			n = n.Left
+		} else {
+			n = n.Right
+		}
+	}
+	t.Insert(c, bounding)
+
+	alpha := t.ScapegoatAlpha
+	if alpha == 0 {
+		alpha = DefaultScapegoatAlpha
+	}
+	base := math.Log(1 / alpha)
+	if float64(len(path)) <= math.Log(float64(t.Count))/base {
+		return
+	}
+
+	// Find the scapegoat by walking back up the insertion path,
+	// counting the nodes in each subtree.
+	var child *Node
+	if last := path[len(path)-1]; c.Compare(last.Point, last.Plane) <= 0 {
+		child = last.Left
+	} else {
+		child = last.Right
+	}
+	size := 1
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		sibling := n.Left
+		if child == n.Left {
+			sibling = n.Right
+		}
+		total := 1 + size + sibling.size()
+		if float64(len(path)-i) > math.Log(float64(total))/base {
+			r := n.rebuild(total)
+			switch {
+			case i == 0:
+				t.Root = r
+			case path[i-1].Left == n:
+				path[i-1].Left = r
+			default:
+				path[i-1].Right = r
+			}
+			return
+		}
+		child, size = n, total
+	}
+}
+
+// size returns the number of nodes in the subtree rooted at n.
+func (n *Node) size() int {
+	if n == nil {
+		return 0
+	}
+	return 1 + n.Left.size() + n.Right.size()
+}
+
+// rebuild returns a balanced subtree holding the size points held by the subtree
+// rooted at n. The returned subtree has the same root plane as n and holds bounding
+// volumes if n does.
+func (n *Node) rebuild(size int) *Node {
+	p := make(comparables, 0, size)
+	n.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		p = append(p, c)
+		return
+	}, 0)
+	if n.Bounding != nil {
+		return buildBounded(p, n.Plane, true)
+	}
+	return build(p, n.Plane)
+}
+
+// boundsFromSubtree returns the tight bounding volume of the points held by the subtree
+// rooted at n, determined using only the Compare method of the points. The points need
+// not be Extenders.
+func boundsFromSubtree(n *Node) *Bounding {
+	if n == nil {
+		return nil
+	}
+	var p []Comparable
+	n.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		p = append(p, c)
+		return
+	}, 0)
+	return extremaBounds(p)
+}
+
+// Bounds returns the tight bounding volume of all the points stored in the tree, computed
+// from the points rather than from any bounding volumes held by the tree's nodes. If all
+// the points are Extenders, the volume is built using their Extend methods, otherwise it
+// is determined using only the Compare method of the points and the corners of the
+// returned Bounding are not of the same type as the stored points. If the tree is empty,
+// Bounds returns nil.
+func (t *Tree) Bounds() *Bounding {
+	if t.Root == nil {
+		return nil
+	}
+	var b *Bounding
+	extend := true
+	t.Root.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		e, ok := c.(Extender)
+		if ok {
+			b = e.Extend(b)
+		}
+		extend = ok && b != nil
+		return !extend
+	}, 0)
+	if extend {
+		return b
+	}
+	return boundsFromSubtree(t.Root)
+}
+
+// Balance rebuilds the tree from its stored points, restoring the balance lost by
+// successive calls to Insert. If the tree holds bounding volumes, bounding volumes are
+// rebuilt for each node. If any of the stored points is not an Extender, the volumes
+// are determined using only the Compare method of the points.
+func (t *Tree) Balance() {
+	if t.Root == nil {
+		return
+	}
+	p := make(comparables, 0, t.Count)
+	t.Root.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		p = append(p, c)
+		return
+	}, 0)
+	alpha := t.ScapegoatAlpha
+	*t = *New(p, t.Root.Bounding != nil)
+	t.ScapegoatAlpha = alpha
+}
+
+// RebuildWith rebuilds the tree from its stored points in the same way as Balance, choosing
+// the pivot at each node according to strategy. If bounding is true, bounding volumes are
+// determined for each node.
+func (t *Tree) RebuildWith(strategy PivotStrategy, bounding bool) {
+	if t.Root == nil {
+		return
+	}
+	p := make(comparables, 0, t.Count)
+	t.Root.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		p = append(p, c)
+		return
+	}, 0)
+	alpha := t.ScapegoatAlpha
+	*t = *New(strategic{comparables: p, strategy: strategy}, bounding)
+	t.ScapegoatAlpha = alpha
+}
+
+// Filter returns a new balanced tree holding the points stored in t for which pred returns
+// true. If bounding is true, bounding volumes are determined for each node of the new tree.
+// The receiver is not altered.
+func (t *Tree) Filter(pred func(Comparable) bool, bounding bool) *Tree {
+	var p comparables
+	t.Do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		if pred(c) {
+			p = append(p, c)
+		}
+		return
+	})
+	return New(p, bounding)
+}
+
 // Len returns the number of elements in the tree.
 func (t *Tree) Len() int { return t.Count }
 
+// RecountNodes recomputes the Count of the tree by traversing the nodes reachable from
+// Root, and returns the new Count. RecountNodes repairs trees constructed or altered by
+// direct assignment of Nodes.
+func (t *Tree) RecountNodes() int {
+	t.Count = t.Root.size()
+	t.dims = 0
+	return t.Count
+}
+
 // Contains returns whether a Comparable is in the bounds of the tree. If no bounding has
 // been constructed Contains returns true.
 func (t *Tree) Contains(c Comparable) bool {
@@ -236,16 +497,24 @@ var inf = math.Inf(1)
 
 // Nearest returns the nearest value to the query and the distance between them.
 func (t *Tree) Nearest(q Comparable) (Comparable, float64) {
-	if t.Root == nil {
-		return nil, inf
-	}
-	n, dist := t.Root.search(q, inf)
+	n, dist := t.NearestNode(q)
 	if n == nil {
 		return nil, inf
 	}
 	return n.Point, dist
 }
 
+// NearestNode returns the node holding the nearest value to the query and the distance
+// between them. The returned node's Point may be replaced in place with a value that has
+// the same coordinates, for example to update an associated payload, but altering its
+// coordinates invalidates the tree and requires it to be rebuilt.
+func (t *Tree) NearestNode(q Comparable) (*Node, float64) {
+	if t.Root == nil {
+		return nil, inf
+	}
+	return t.Root.search(q, inf)
+}
+
 func (n *Node) search(q Comparable, dist float64) (*Node, float64) {
 	if n == nil {
 		return nil, inf
@@ -283,6 +552,299 @@ func (n *Node) search(q Comparable, dist float64) (*Node, float64) {
 	return bn, dist
 }
 
+// RemoveNearest removes the nearest value to the query from the tree and returns it and
+// the distance between them. The removed node is replaced by the value in one of its
+// subtrees that is extreme along the node's splitting plane, and that value's node is
+// removed in turn, until a leaf is reached. If the stored points are Extenders the
+// bounding volumes of the nodes on the altered path are tightened. If the tree is empty,
+// RemoveNearest returns false.
+func (t *Tree) RemoveNearest(q Comparable) (Comparable, float64, bool) {
+	if t.Root == nil {
+		return nil, inf, false
+	}
+	var path []*Node
+	dist := t.Root.searchPath(q, inf, nil, &path)
+	p := path[len(path)-1].Point
+	t.removeAt(path)
+	t.Count--
+	return p, dist, true
+}
+
+// searchPath performs a nearest neighbour search in the same way as search, but records
+// the path from the root to the nearest node in best rather than returning the node. The
+// path from the root to n, excluding n, is held in path. The returned distance is that of
+// the nearest node found, or dist if no node is nearer.
+func (n *Node) searchPath(q Comparable, dist float64, path []*Node, best *[]*Node) float64 {
+	if n == nil {
+		return dist
+	}
+	path = append(path, n)
+	if d := q.Distance(n.Point); d < dist || *best == nil {
+		dist = d
+		*best = append((*best)[:0], path...)
+	}
+
+	c := q.Compare(n.Point, n.Plane)
+	near, far := n.Left, n.Right
+	if c > 0 {
+		near, far = far, near
+	}
+	dist = near.searchPath(q, dist, path, best)
+	if c*c < dist {
+		dist = far.searchPath(q, dist, path, best)
+	}
+	return dist
+}
+
+// removeAt removes the node at the end of path, which must be the path from the root of
+// the tree to the node, without altering the tree's Count.
+func (t *Tree) removeAt(path []*Node) {
+	for {
+		n := path[len(path)-1]
+		// Points equal to n along its plane may be held in either subtree,
+		// so the minimum of the right subtree and the maximum of the left
+		// subtree both preserve the partition at n.
+		switch {
+		case n.Right != nil:
+			path = n.Right.extremePath(n.Plane, false, path)
+		case n.Left != nil:
+			path = n.Left.extremePath(n.Plane, true, path)
+		default:
+			switch i := len(path) - 2; {
+			case i < 0:
+				t.Root = nil
+			case path[i].Left == n:
+				path[i].Left = nil
+			default:
+				path[i].Right = nil
+			}
+			for i := len(path) - 2; i >= 0; i-- {
+				path[i].tighten()
+			}
+			return
+		}
+		n.Point = path[len(path)-1].Point
+	}
+}
+
+// extremePath returns path with the path from n to the node in the subtree rooted at n
+// holding the minimum value along dimension d appended, or the maximum value if max is
+// true.
+func (n *Node) extremePath(d Dim, max bool, path []*Node) []*Node {
+	path = append(path, n)
+	if n.Plane == d {
+		next := n.Left
+		if max {
+			next = n.Right
+		}
+		if next == nil {
+			return path
+		}
+		return next.extremePath(d, max, path)
+	}
+	best := path
+	for _, ch := range []*Node{n.Left, n.Right} {
+		if ch == nil {
+			continue
+		}
+		// Prevent the paths of the two subtrees sharing a backing array.
+		p := ch.extremePath(d, max, path[:len(path):len(path)])
+		c := p[len(p)-1].Point.Compare(best[len(best)-1].Point, d)
+		if (max && c > 0) || (!max && c < 0) {
+			best = p
+		}
+	}
+	return best
+}
+
+// tighten recomputes the bounding volume of n from its point and the bounding volumes
+// of its children. The volume is left unaltered unless n holds a bounding volume and all
+// the points and corners involved are Extenders.
+func (n *Node) tighten() {
+	if n.Bounding == nil {
+		return
+	}
+	e, ok := n.Point.(Extender)
+	if !ok {
+		return
+	}
+	b := e.Extend(nil)
+	for _, ch := range []*Node{n.Left, n.Right} {
+		if ch == nil {
+			continue
+		}
+		if ch.Bounding == nil {
+			return
+		}
+		for _, corner := range ch.Bounding {
+			e, ok := corner.(Extender)
+			if !ok {
+				return
+			}
+			b = e.Extend(b)
+		}
+	}
+	if b != nil {
+		n.Bounding = b
+	}
+}
+
+// NearestToBounds returns the value stored in the tree nearest to the volume b and the
+// distance between them, as determined by distToBox, which should return zero for a point
+// within b. Subtrees are pruned using the separation between b and the splitting plane of
+// each node, so the square of the difference between coordinates returned by Compare must
+// be a lower bound of the distance returned by distToBox, as is the case for the squared
+// Euclidean distance. If the tree is empty, NearestToBounds returns nil and +Inf.
+func (t *Tree) NearestToBounds(b *Bounding, distToBox func(Comparable, *Bounding) float64) (Comparable, float64) {
+	n, dist := t.Root.searchBounds(b, distToBox, nil, inf)
+	if n == nil {
+		return nil, inf
+	}
+	return n.Point, dist
+}
+
+func (n *Node) searchBounds(b *Bounding, distToBox func(Comparable, *Bounding) float64, bn *Node, dist float64) (*Node, float64) {
+	if n == nil {
+		return bn, dist
+	}
+	if d := distToBox(n.Point, b); d < dist {
+		bn, dist = n, d
+	}
+
+	// Determine lower bounds on the distance from b to each side of the splitting plane.
+	var lb, rb float64
+	if c := b[0].Compare(n.Point, n.Plane); c > 0 {
+		lb = c * c
+	}
+	if c := b[1].Compare(n.Point, n.Plane); c < 0 {
+		rb = c * c
+	}
+	near, far := n.Left, n.Right
+	if rb < lb {
+		near, far = far, near
+		lb, rb = rb, lb
+	}
+	if lb < dist {
+		bn, dist = near.searchBounds(b, distToBox, bn, dist)
+	}
+	if rb < dist {
+		bn, dist = far.searchBounds(b, distToBox, bn, dist)
+	}
+	return bn, dist
+}
+
+// NearestUntil returns a value near to the query and the distance between them. The search
+// proceeds as for Nearest, but stops as soon as good returns true for the distance to the
+// best value found so far, so the returned value may not be the nearest. NearestUntil trades
+// exactness for bounded work; if good never returns true, the result is the same as Nearest.
+func (t *Tree) NearestUntil(q Comparable, good func(dist float64) bool) (Comparable, float64) {
+	if t.Root == nil {
+		return nil, inf
+	}
+	n, dist, _ := t.Root.searchUntil(q, inf, good)
+	if n == nil {
+		return nil, inf
+	}
+	return n.Point, dist
+}
+
+func (n *Node) searchUntil(q Comparable, dist float64, good func(float64) bool) (bn *Node, bd float64, stop bool) {
+	if n == nil {
+		return nil, inf, false
+	}
+
+	if d := q.Distance(n.Point); d < dist {
+		bn, dist = n, d
+		if good(dist) {
+			return bn, dist, true
+		}
+	}
+
+	c := q.Compare(n.Point, n.Plane)
+	near, far := n.Left, n.Right
+	if c > 0 {
+		near, far = far, near
+	}
+	nn, nd, stop := near.searchUntil(q, dist, good)
+	if nd < dist {
+		bn, dist = nn, nd
+	}
+	if stop || c*c >= dist {
+		return bn, dist, stop
+	}
+	fn, fd, stop := far.searchUntil(q, dist, good)
+	if fd < dist {
+		bn, dist = fn, fd
+	}
+	return bn, dist, stop
+}
+
+// NearestSubspace returns the nearest value to the query and the distance between them
+// considering only the dimensions listed in dims. The distance is calculated as the sum of
+// the squares of q.Compare along each of the listed dimensions, so it agrees with the
+// Distance method of Comparables, like Point, that use the squared Euclidean distance.
+func (t *Tree) NearestSubspace(q Comparable, dims []Dim) (Comparable, float64) {
+	if t.Root == nil {
+		return nil, inf
+	}
+	in := make([]bool, q.Dims())
+	for _, d := range dims {
+		in[d] = true
+	}
+	n, dist := t.Root.searchSubspace(q, dims, in, inf)
+	if n == nil {
+		return nil, inf
+	}
+	return n.Point, dist
+}
+
+func (n *Node) searchSubspace(q Comparable, dims []Dim, in []bool, dist float64) (*Node, float64) {
+	if n == nil {
+		return nil, inf
+	}
+
+	var d float64
+	for _, dim := range dims {
+		c := q.Compare(n.Point, dim)
+		d += c * c
+	}
+	bn := n
+	if d >= dist {
+		bn = nil
+	} else {
+		dist = d
+	}
+
+	if !in[n.Plane] {
+		ln, ld := n.Left.searchSubspace(q, dims, in, dist)
+		if ld < dist {
+			bn, dist = ln, ld
+		}
+		rn, rd := n.Right.searchSubspace(q, dims, in, dist)
+		if rd < dist {
+			bn, dist = rn, rd
+		}
+		return bn, dist
+	}
+
+	c := q.Compare(n.Point, n.Plane)
+	near, far := n.Left, n.Right
+	if c > 0 {
+		near, far = far, near
+	}
+	nn, nd := near.searchSubspace(q, dims, in, dist)
+	if nd < dist {
+		bn, dist = nn, nd
+	}
+	if c*c < dist {
+		fn, fd := far.searchSubspace(q, dims, in, dist)
+		if fd < dist {
+			bn, dist = fn, fd
+		}
+	}
+	return bn, dist
+}
+
 // ComparableDist holds a Comparable and a distance to a specific query. A nil Comparable
 // is used to mark the end of the heap, so clients should not store nil values except for
 // this purpose.
@@ -291,12 +853,28 @@ type ComparableDist struct {
 	Dist       float64
 }
 
-// Heap is a max heap sorted on Dist.
+// further returns whether a is further from the query than b. Ties in distance
+// are broken by comparing the coordinates of the Comparables in order of dimension,
+// with a lower coordinate considered nearer.
+func (a ComparableDist) further(b ComparableDist) bool {
+	if a.Dist != b.Dist || a.Comparable == nil || b.Comparable == nil {
+		return a.Dist > b.Dist
+	}
+	for d := Dim(0); d < Dim(a.Comparable.Dims()); d++ {
+		if c := a.Comparable.Compare(b.Comparable, d); c != 0 {
+			return c > 0
+		}
+	}
+	return false
+}
+
+// Heap is a max heap sorted on Dist. Ties in Dist are broken by comparing the coordinates
+// of the Comparables in order of dimension, with a lower coordinate considered nearer.
 type Heap []ComparableDist
 
 func (h *Heap) Max() ComparableDist  { return (*h)[0] }
 func (h *Heap) Len() int             { return len(*h) }
-func (h *Heap) Less(i, j int) bool   { return (*h)[i].Comparable == nil || (*h)[i].Dist > (*h)[j].Dist }
+func (h *Heap) Less(i, j int) bool   { return (*h)[i].Comparable == nil || (*h)[i].further((*h)[j]) }
 func (h *Heap) Swap(i, j int)        { (*h)[i], (*h)[j] = (*h)[j], (*h)[i] }
 func (h *Heap) Push(x interface{})   { (*h) = append(*h, x.(ComparableDist)) }
 func (h *Heap) Pop() (i interface{}) { i, *h = (*h)[len(*h)-1], (*h)[:len(*h)-1]; return i }
@@ -314,11 +892,11 @@ func NewNKeeper(n int) *NKeeper {
 	return &k
 }
 
-// Keep add c to the heap if its distance is less than the maximum value of the heap. If adding
-// c would increase the size of the heap beyond the initial maximum length, the maximum value of
-// the heap is dropped.
+// Keep add c to the heap if its distance is less than the maximum value of the heap, or is
+// equal to it and c is nearer according to the Heap tie-breaking rule. If adding c would increase
+// the size of the heap beyond the initial maximum length, the maximum value of the heap is dropped.
 func (k *NKeeper) Keep(c ComparableDist) {
-	if c.Dist < k.Heap[0].Dist {
+	if k.Heap[0].further(c) {
 		if len(k.Heap) == cap(k.Heap) {
 			heap.Pop(k)
 		}
@@ -326,6 +904,13 @@ func (k *NKeeper) Keep(c ComparableDist) {
 	}
 }
 
+// Reset empties the NKeeper so that it may be reused for another search, retaining its
+// allocated storage.
+func (k *NKeeper) Reset() {
+	k.Heap = k.Heap[:1]
+	k.Heap[0] = ComparableDist{Comparable: nil, Dist: inf}
+}
+
 // DistKeeper is a Keeper that retains the ComparableDists within the specified distance of the
 // query that it is called to Keep.
 type DistKeeper struct {
@@ -353,7 +938,9 @@ type Keeper interface {
 // NearestSet finds the nearest values to the query accepted by the provided Keeper, k.
 // k must be able to return a ComparableDist specifying the maximum acceptable distance
 // when Max() is called, and retains the results of the search in min sorted order after
-// the call to NearestSet returns.
+// the call to NearestSet returns. When k is an NKeeper or DistKeeper, values at equal
+// distance from the query are ordered according to the Heap tie-breaking rule, so results
+// are deterministic.
 func (t *Tree) NearestSet(k Keeper, q Comparable) {
 	if t.Root == nil {
 		return
@@ -375,6 +962,15 @@ func (t *Tree) NearestSet(k Keeper, q Comparable) {
 	}
 }
 
+// NearestNKeeper finds the nearest values to the query, retaining at most the capacity
+// of keep, in the same way as NearestSet. keep is Reset before the search, so a single
+// NKeeper may be reused across many queries without allocation. The results are held in
+// keep.Heap in min sorted order until keep is next used.
+func (t *Tree) NearestNKeeper(q Comparable, keep *NKeeper) {
+	keep.Reset()
+	t.NearestSet(keep, q)
+}
+
 func (n *Node) searchSet(q Comparable, k Keeper) {
 	if n == nil {
 		return
@@ -396,6 +992,36 @@ func (n *Node) searchSet(q Comparable, k Keeper) {
 	return
 }
 
+// ClassifyKNN returns the plurality label among the k nearest values to the query q, and
+// the tally of votes for each label, where labelOf returns the label of a stored value.
+// Ties in votes are resolved to the label of the nearest value holding one of the tied
+// labels, so a tie involving the label of the single nearest value resolves to that label.
+// If the tree is empty or k is less than one, the empty string and a nil tally are returned.
+func (t *Tree) ClassifyKNN(k int, q Comparable, labelOf func(Comparable) string) (string, map[string]int) {
+	if t.Root == nil || k < 1 {
+		return "", nil
+	}
+	keep := NewNKeeper(k)
+	t.NearestSet(keep, q)
+
+	votes := make(map[string]int)
+	var max int
+	for _, c := range keep.Heap {
+		l := labelOf(c.Comparable)
+		votes[l]++
+		if votes[l] > max {
+			max = votes[l]
+		}
+	}
+	var label string
+	for i := len(keep.Heap) - 1; i >= 0; i-- {
+		if l := labelOf(keep.Heap[i].Comparable); votes[l] == max {
+			label = l
+		}
+	}
+	return label, votes
+}
+
 // An Operation is a function that operates on a Comparable. The bounding volume and tree depth
 // of the point is also provided. If done is returned true, the Operation is indicating that no
 // further work needs to be done and so the Do function should traverse no further.
@@ -428,6 +1054,50 @@ func (n *Node) do(fn Operation, depth int) (done bool) {
 	return
 }
 
+// DoLeaves performs fn on all values stored in leaf nodes of the tree, those nodes with no
+// children, in the same order as Do. A boolean is returned indicating whether the DoLeaves
+// traversal was interrupted by an Operation returning true. If fn alters stored values' sort
+// relationships, future tree operation behaviors are undefined.
+func (t *Tree) DoLeaves(fn Operation) bool {
+	if t.Root == nil {
+		return false
+	}
+	return t.Root.doLeaves(fn, 0)
+}
+
+func (n *Node) doLeaves(fn Operation, depth int) (done bool) {
+	if n.Left == nil && n.Right == nil {
+		return fn(n.Point, n.Bounding, depth)
+	}
+	if n.Left != nil {
+		done = n.Left.doLeaves(fn, depth+1)
+		if done {
+			return
+		}
+	}
+	if n.Right != nil {
+		done = n.Right.doLeaves(fn, depth+1)
+	}
+	return
+}
+
+// DepthHistogram returns a histogram of the depths of the leaf nodes of the tree, where
+// the element at index d holds the number of leaves at depth d and the root is at depth
+// zero. The leaves of a balanced tree are concentrated at a few adjacent depths,
+// while those of a degenerate tree are spread over many. If the tree is empty,
+// DepthHistogram returns nil.
+func (t *Tree) DepthHistogram() []int {
+	var h []int
+	t.DoLeaves(func(_ Comparable, _ *Bounding, depth int) (done bool) {
+		for len(h) <= depth {
+			h = append(h, 0)
+		}
+		h[depth]++
+		return
+	})
+	return h
+}
+
 // DoBounded performs fn on all values stored in the tree that are within the specified bound.
 // If b is nil, the result is the same as a Do. A boolean is returned indicating whether the
 // DoBounded traversal was interrupted by an Operation returning true. If fn alters stored
@@ -443,7 +1113,7 @@ func (t *Tree) DoBounded(fn Operation, b *Bounding) bool {
 }
 
 func (n *Node) doBounded(fn Operation, b *Bounding, depth int) (done bool) {
-	if n.Left != nil && b[0].Compare(n.Point, n.Plane) < 0 {
+	if n.Left != nil && b[0].Compare(n.Point, n.Plane) <= 0 {
 		done = n.Left.doBounded(fn, b, depth+1)
 		if done {
 			return
@@ -455,8 +1125,107 @@ func (n *Node) doBounded(fn Operation, b *Bounding, depth int) (done bool) {
 			return
 		}
 	}
-	if n.Right != nil && 0 < b[1].Compare(n.Point, n.Plane) {
+	if n.Right != nil && 0 <= b[1].Compare(n.Point, n.Plane) {
 		done = n.Right.doBounded(fn, b, depth+1)
 	}
 	return
 }
+
+// PointsInBox returns all the values stored in the tree that are within the box with the
+// corners min and max. The box is closed, so points lying on the faces of the box are
+// included, as determined by Bounding.Contains.
+func (t *Tree) PointsInBox(min, max Comparable) []Comparable {
+	var p []Comparable
+	t.DoBounded(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		p = append(p, c)
+		return
+	}, &Bounding{min, max})
+	return p
+}
+
+// DoInRegion performs fn on all values stored in the tree for which accept returns true,
+// allowing queries against arbitrary regions such as half-spaces or convex polygons. The
+// prune function is called with the bounding volume of each subtree and should return
+// true if no value within that volume can be accepted, in which case the subtree is not
+// visited. Pruning is only performed when the tree holds bounding volumes; otherwise every
+// value is tested with accept. A boolean is returned indicating whether the traversal was
+// interrupted by fn returning true. If fn alters stored values' sort relationships future
+// tree operation behaviors are undefined.
+func (t *Tree) DoInRegion(prune func(*Bounding) bool, accept func(Comparable) bool, fn func(Comparable) bool) bool {
+	if t.Root == nil {
+		return false
+	}
+	return t.Root.doInRegion(prune, accept, fn)
+}
+
+func (n *Node) doInRegion(prune func(*Bounding) bool, accept func(Comparable) bool, fn func(Comparable) bool) (done bool) {
+	if n.Bounding != nil && prune(n.Bounding) {
+		return
+	}
+	if n.Left != nil {
+		done = n.Left.doInRegion(prune, accept, fn)
+		if done {
+			return
+		}
+	}
+	if accept(n.Point) {
+		done = fn(n.Point)
+		if done {
+			return
+		}
+	}
+	if n.Right != nil {
+		done = n.Right.doInRegion(prune, accept, fn)
+	}
+	return
+}
+
+// CountDistinctInBounds returns the number of distinct keys among the values stored in the
+// tree that are within the bounding volume b, as determined by Bounding.Contains, where keyOf
+// returns the key of a value. Keys are compared using Go map key equality, so the values
+// returned by keyOf must be hashable, otherwise CountDistinctInBounds will panic. A nil b
+// counts the distinct keys of all values stored in the tree.
+func (t *Tree) CountDistinctInBounds(b *Bounding, keyOf func(Comparable) interface{}) int {
+	seen := make(map[interface{}]struct{})
+	t.DoBounded(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		seen[keyOf(c)] = struct{}{}
+		return
+	}, b)
+	return len(seen)
+}
+
+// SpatialJoin performs fn on every pair of values, pa stored in a and pb stored in b, that
+// are within the distance r of each other, as measured by the Distance method of pa. The
+// distance between the pair is passed to fn. For each value in a, the search through b is
+// pruned using the structure of b. The order in which pairs are presented is not defined.
+// A boolean is returned indicating whether the join was interrupted by fn returning true.
+func SpatialJoin(a, b *Tree, r float64, fn func(pa, pb Comparable, dist float64) (done bool)) bool {
+	if a.Root == nil || b.Root == nil {
+		return false
+	}
+	return a.Root.do(func(pa Comparable, _ *Bounding, _ int) (done bool) {
+		return b.Root.searchWithin(pa, r, fn)
+	}, 0)
+}
+
+func (n *Node) searchWithin(q Comparable, r float64, fn func(pa, pb Comparable, dist float64) bool) (done bool) {
+	if n == nil {
+		return false
+	}
+
+	if d := q.Distance(n.Point); d <= r {
+		if fn(q, n.Point, d) {
+			return true
+		}
+	}
+	c := q.Compare(n.Point, n.Plane)
+	if c <= 0 || c*c <= r {
+		if n.Left.searchWithin(q, r, fn) {
+			return true
+		}
+	}
+	if c > 0 || c*c <= r {
+		return n.Right.searchWithin(q, r, fn)
+	}
+	return false
+}
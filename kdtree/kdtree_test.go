@@ -7,6 +7,7 @@ package kdtree
 import (
 	"flag"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
@@ -16,6 +17,8 @@ import (
 	"unsafe"
 
 	"gopkg.in/check.v1"
+
+	"github.com/biogo/store/internal/testutil"
 )
 
 var (
@@ -34,14 +37,8 @@ var (
 	wpData   = Points{{2, 3}, {5, 4}, {9, 6}, {4, 7}, {8, 1}, {7, 2}}
 	nbWpData = nbPoints{{2, 3}, {5, 4}, {9, 6}, {4, 7}, {8, 1}, {7, 2}}
 	wpBound  = &Bounding{Point{2, 1}, Point{9, 7}}
-	bData    = func(i int) Points {
-		p := make(Points, i)
-		for i := range p {
-			p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
-		}
-		return p
-	}(1e2)
-	bTree = New(bData, true)
+	bData    = benchPoints(testutil.New(1).Points(1e2, 3))
+	bTree    = New(bData, true)
 )
 
 func (s *S) TestNew(c *check.C) {
@@ -88,6 +85,33 @@ func (s *S) TestNew(c *check.C) {
 	}
 }
 
+func (s *S) TestBuildFrom(c *check.C) {
+	raw := make([][]float64, 1000)
+	for i := range raw {
+		raw[i] = []float64{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	orig := append([][]float64(nil), raw...)
+	p := make(Points, len(raw))
+	for i, v := range raw {
+		p[i] = Point(v)
+	}
+	for _, bounding := range []bool{false, true} {
+		t := BuildFrom(raw, bounding)
+		c.Check(raw, check.DeepEquals, orig)
+		c.Check(t.Len(), check.Equals, len(raw))
+		c.Check(t.Root.isKDTree(), check.Equals, true)
+		et := New(append(Points(nil), p...), bounding)
+		c.Check(t.Root.Bounding, check.DeepEquals, et.Root.Bounding)
+		for i := 0; i < 100; i++ {
+			q := Point{rand.Float64(), rand.Float64(), rand.Float64()}
+			got, d := t.Nearest(q)
+			want, ed := et.Nearest(q)
+			c.Check(got, check.DeepEquals, want, check.Commentf("Test %d: query %.3f", i, q))
+			c.Check(d, check.Equals, ed)
+		}
+	}
+}
+
 func (s *S) TestInsert(c *check.C) {
 	for i, test := range []struct {
 		data   Interface
@@ -121,6 +145,353 @@ func (s *S) TestInsert(c *check.C) {
 	}
 }
 
+// plainPoint is a Comparable that is not an Extender.
+type plainPoint Point
+
+func (p plainPoint) Compare(c Comparable, d Dim) float64 {
+	if q, ok := c.(plainPoint); ok {
+		return p[d] - q[d]
+	}
+	return p[d] - c.(Point)[d]
+}
+func (p plainPoint) Dims() int                     { return len(p) }
+func (p plainPoint) Distance(c Comparable) float64 { return Point(p).Distance(c) }
+
+func (s *S) TestInsertReport(c *check.C) {
+	t := New(append(Points(nil), wpData...), true)
+	c.Check(t.InsertReport(Point{1, 1}, true), check.Equals, true)
+	c.Check(t.Root.Bounding, check.DeepEquals, &Bounding{Point{1, 1}, Point{9, 7}})
+	c.Check(t.InsertReport(plainPoint{2, 2}, true), check.Equals, false)
+	c.Check(t.Root.Bounding, check.IsNil)
+	c.Check(t.Len(), check.Equals, len(wpData)+2)
+
+	t = &Tree{}
+	c.Check(t.InsertReport(Point{1, 1}, false), check.Equals, false)
+	c.Check(t.InsertReport(Point{2, 2}, true), check.Equals, false)
+	t = &Tree{}
+	c.Check(t.InsertReport(Point{1, 1}, true), check.Equals, true)
+	c.Check(t.InsertReport(Point{2, 2}, false), check.Equals, true)
+	c.Check(t.InsertReport(plainPoint{3, 3}, true), check.Equals, false)
+}
+
+func (s *S) TestDimsMismatch(c *check.C) {
+	t := New(Points{{1, 2, 3}, {4, 5, 6}}, false)
+	c.Check(t.Dims(), check.Equals, 3)
+	c.Check(func() { t.Insert(Point{1, 2}, false) }, check.PanicMatches, "kdtree: dimension mismatch: point has 2 dimensions, tree has 3")
+	c.Check(func() { t.InsertBalanced(Point{1, 2}, false) }, check.PanicMatches, "kdtree: dimension mismatch: .*")
+	c.Check(t.Len(), check.Equals, 2)
+	t.Insert(Point{7, 8, 9}, false)
+	c.Check(t.Len(), check.Equals, 3)
+
+	c.Check(func() { New(Points{{1, 2, 3}, {4, 5}}, false) }, check.PanicMatches, "kdtree: dimension mismatch: .*")
+
+	t = &Tree{}
+	c.Check(t.Dims(), check.Equals, 0)
+	t.Insert(Point{1, 2}, false)
+	c.Check(t.Dims(), check.Equals, 2)
+	c.Check(func() { t.Insert(Point{1, 2, 3}, false) }, check.PanicMatches, "kdtree: dimension mismatch: point has 3 dimensions, tree has 2")
+}
+
+func (s *S) TestBalance(c *check.C) {
+	for i, test := range []struct {
+		data   Interface
+		insert []Comparable
+		bounds *Bounding
+	}{
+		{
+			append(Points(nil), wpData...),
+			[]Comparable{Point{0, 0}, Point{10, 10}, Point{1, 1}, Point{2, 2}, Point{3, 9}},
+			&Bounding{Point{0, 0}, Point{10, 10}},
+		},
+		{
+			append(Points(nil), wpData...),
+			[]Comparable{Point{5, 5}, Point{6, 6}, Point{7, 7}},
+			&Bounding{Point{2, 1}, Point{9, 7}},
+		},
+		{
+			append(nbPoints(nil), nbWpData...),
+			[]Comparable{nbPoint{0, 0}, nbPoint{10, 10}},
+			nil,
+		},
+	} {
+		t := New(test.data, true)
+		for _, v := range test.insert {
+			t.Insert(v, true)
+		}
+		var before []Comparable
+		t.Do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+			before = append(before, c)
+			return
+		})
+
+		t.Balance()
+		c.Check(t.Len(), check.Equals, len(before), check.Commentf("Test %d", i))
+		c.Check(t.Root.isKDTree(), check.Equals, true, check.Commentf("Test %d", i))
+		c.Check(t.Root.Bounding, check.DeepEquals, test.bounds, check.Commentf("Test %d", i))
+		for _, p := range before {
+			q, d := t.Nearest(p)
+			c.Check(q, check.DeepEquals, p)
+			c.Check(d, check.Equals, 0.)
+		}
+		if c.Failed() && *genDot && t.Len() <= *dotLimit {
+			err := dotFile(t, fmt.Sprintf("TestBalance%T", test.data), "")
+			if err != nil {
+				c.Errorf("Dot file write failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *S) TestRebuildWith(c *check.C) {
+	// structure returns a pre-order description of the subtree rooted at n.
+	var structure func(n *Node) string
+	structure = func(n *Node) string {
+		if n == nil {
+			return "()"
+		}
+		return fmt.Sprintf("(%v %s %s)", n, structure(n.Left), structure(n.Right))
+	}
+
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	var want Points
+	New(append(Points(nil), p...), false).Do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		want = append(want, c.(Point))
+		return
+	})
+	sort.Slice(want, func(i, j int) bool { return want[i][0] < want[j][0] })
+
+	for _, strategy := range []PivotStrategy{PivotMedianOfRandoms, PivotMedianOfMedians, PivotMedian} {
+		for _, bounding := range []bool{false, true} {
+			t := &Tree{}
+			for _, q := range p {
+				t.Insert(q, bounding)
+			}
+			t.RebuildWith(strategy, bounding)
+			c.Check(t.Len(), check.Equals, len(p))
+			c.Check(t.Root.isKDTree(), check.Equals, true, check.Commentf("strategy %d", strategy))
+			if bounding {
+				c.Check(t.Root.Bounding, check.DeepEquals, t.Bounds())
+			} else {
+				c.Check(t.Root.Bounding, check.IsNil)
+			}
+			var got Points
+			t.Do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+				got = append(got, c.(Point))
+				return
+			})
+			sort.Slice(got, func(i, j int) bool { return got[i][0] < got[j][0] })
+			c.Check(got, check.DeepEquals, want)
+		}
+	}
+
+	t := New(append(Points(nil), p...), false)
+	t.RebuildWith(PivotMedian, false)
+	first := structure(t.Root)
+	t.RebuildWith(PivotMedian, false)
+	c.Check(structure(t.Root), check.Equals, first)
+
+	// The structure does not depend on the order of the points.
+	q := append(Points(nil), p...)
+	rand.Shuffle(len(q), func(i, j int) { q[i], q[j] = q[j], q[i] })
+	t = &Tree{}
+	for _, e := range q {
+		t.Insert(e, false)
+	}
+	t.RebuildWith(PivotMedian, false)
+	c.Check(structure(t.Root), check.Equals, first)
+}
+
+func (s *S) TestRecountNodes(c *check.C) {
+	t := &Tree{Count: 3}
+	c.Check(t.RecountNodes(), check.Equals, 0)
+	c.Check(t.Len(), check.Equals, 0)
+
+	t = &Tree{
+		Root: &Node{
+			Point: Point{5, 4},
+			Left:  &Node{Point: Point{2, 3}, Plane: 1},
+			Right: &Node{
+				Point: Point{9, 6},
+				Plane: 1,
+				Left:  &Node{Point: Point{8, 1}},
+			},
+		},
+		Count: 1,
+	}
+	c.Check(t.RecountNodes(), check.Equals, 4)
+	c.Check(t.Len(), check.Equals, 4)
+	c.Check(t.Root.isKDTree(), check.Equals, true)
+	t.Insert(Point{7, 2}, false)
+	c.Check(t.Len(), check.Equals, 5)
+	c.Check(t.RecountNodes(), check.Equals, 5)
+	c.Check(func() { t.Insert(Point{1, 2, 3}, false) }, check.Panics, dimsMismatch(3, 2))
+}
+
+func (s *S) TestFilter(c *check.C) {
+	t := New(append(Points(nil), wpData...), true)
+	before := t.Root.String()
+	for i, test := range []struct {
+		pred     func(Comparable) bool
+		want     Points
+		bounding bool
+		bounds   *Bounding
+	}{
+		{
+			pred:     func(p Comparable) bool { return p.(Point)[0] >= 5 },
+			want:     Points{{5, 4}, {7, 2}, {8, 1}, {9, 6}},
+			bounding: true,
+			bounds:   &Bounding{Point{5, 1}, Point{9, 6}},
+		},
+		{
+			pred: func(p Comparable) bool { return p.(Point)[1] < 4 },
+			want: Points{{2, 3}, {7, 2}, {8, 1}},
+		},
+		{
+			pred:     func(Comparable) bool { return false },
+			bounding: true,
+		},
+	} {
+		f := t.Filter(test.pred, test.bounding)
+		c.Check(f.Len(), check.Equals, len(test.want), check.Commentf("Test %d", i))
+		c.Check(f.Root.isKDTree(), check.Equals, true, check.Commentf("Test %d", i))
+		var got Points
+		f.Do(func(p Comparable, _ *Bounding, _ int) (done bool) {
+			got = append(got, p.(Point))
+			return
+		})
+		sort.Slice(got, func(i, j int) bool { return got[i][0] < got[j][0] })
+		c.Check(got, check.DeepEquals, test.want, check.Commentf("Test %d", i))
+		if f.Root != nil {
+			c.Check(f.Root.Bounding, check.DeepEquals, test.bounds, check.Commentf("Test %d", i))
+		}
+	}
+	c.Check(t.Len(), check.Equals, len(wpData))
+	c.Check(t.Root.String(), check.Equals, before)
+}
+
+func (s *S) TestBounds(c *check.C) {
+	c.Check((&Tree{}).Bounds(), check.IsNil)
+	for _, bounding := range []bool{false, true} {
+		t := New(append(Points(nil), wpData...), bounding)
+		c.Check(t.Bounds(), check.DeepEquals, wpBound, check.Commentf("bounding=%t", bounding))
+		t.Insert(Point{10, 0}, bounding)
+		c.Check(t.Bounds(), check.DeepEquals, &Bounding{Point{2, 0}, Point{10, 7}}, check.Commentf("bounding=%t", bounding))
+	}
+
+	// Non-Extender points are bounded using Compare.
+	t := New(append(nbPoints(nil), nbWpData...), false)
+	b := t.Bounds()
+	c.Assert(b, check.NotNil)
+	for d := Dim(0); d < 2; d++ {
+		c.Check(b[0].Compare(nbPoint(wpBound[0].(Point)), d), check.Equals, 0.)
+		c.Check(b[1].Compare(nbPoint(wpBound[1].(Point)), d), check.Equals, 0.)
+	}
+	t.Do(func(p Comparable, _ *Bounding, _ int) (done bool) {
+		c.Check(b.Contains(p), check.Equals, true)
+		return
+	})
+}
+
+func (s *S) TestBoundsFromSubtree(c *check.C) {
+	c.Check(boundsFromSubtree(nil), check.IsNil)
+
+	p := make(nbPoints, 1000)
+	for i := range p {
+		p[i] = nbPoint{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t := New(append(nbPoints(nil), p...), false)
+	for _, n := range []*Node{t.Root, t.Root.Left, t.Root.Right.Left} {
+		var sub nbPoints
+		n.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+			sub = append(sub, c.(nbPoint))
+			return
+		}, 0)
+		min := append(nbPoint(nil), sub[0]...)
+		max := append(nbPoint(nil), sub[0]...)
+		for _, e := range sub[1:] {
+			for d, v := range e {
+				min[d] = math.Min(min[d], v)
+				max[d] = math.Max(max[d], v)
+			}
+		}
+		b := boundsFromSubtree(n)
+		c.Assert(b, check.NotNil)
+		for d := range min {
+			c.Check(b[0].(corner)[d].(nbPoint)[d], check.Equals, min[d])
+			c.Check(b[1].(corner)[d].(nbPoint)[d], check.Equals, max[d])
+		}
+		for _, e := range sub {
+			c.Check(b.Contains(e), check.Equals, true)
+		}
+		c.Check(b.Contains(nbPoint{min[0] - 1, min[1], min[2]}), check.Equals, false)
+		c.Check(b.Contains(nbPoint{min[0], min[1], max[2] + 1}), check.Equals, false)
+	}
+
+	// Balance restores bounding volumes for points that are not Extenders.
+	t.Root.Bounding = boundsFromSubtree(t.Root)
+	t.Balance()
+	c.Assert(t.Root.Bounding, check.NotNil)
+	c.Check(t.Root.Bounding, check.DeepEquals, boundsFromSubtree(t.Root))
+	for _, e := range p {
+		c.Check(t.Contains(e), check.Equals, true)
+	}
+	c.Check(t.Contains(nbPoint{2, 2, 2}), check.Equals, false)
+}
+
+func (n *Node) height() int {
+	if n == nil {
+		return 0
+	}
+	l, r := n.Left.height(), n.Right.height()
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
+func (s *S) TestInsertBalanced(c *check.C) {
+	for i, test := range []struct {
+		alpha    float64
+		bounding bool
+		point    func(int) Comparable
+	}{
+		{0, false, func(i int) Comparable { return Point{float64(i), float64(i)} }},
+		{0, true, func(i int) Comparable { return Point{float64(i), -float64(i)} }},
+		{0, true, func(i int) Comparable { return nbPoint{float64(-i), float64(i * 3 % 1001)} }},
+		{0.55, false, func(i int) Comparable { return Point{float64(i), float64(i)} }},
+		{0.9, true, func(i int) Comparable { return Point{float64(i), -float64(i)} }},
+	} {
+		t := &Tree{ScapegoatAlpha: test.alpha}
+		alpha := test.alpha
+		if alpha == 0 {
+			alpha = DefaultScapegoatAlpha
+		}
+		for j := 1; j <= 1000; j++ {
+			t.InsertBalanced(test.point(j), test.bounding)
+			c.Assert(t.Len(), check.Equals, j)
+			// Scapegoat trees are loosely height-balanced, so the depth of the
+			// deepest node may exceed log_{1/alpha}(n) by one.
+			limit := int(math.Log(float64(j))/math.Log(1/alpha)) + 2
+			c.Assert(t.Root.height() <= limit, check.Equals, true,
+				check.Commentf("Test %d: height %d exceeds %d after %d insertions", i, t.Root.height(), limit, j))
+			if j%100 == 0 {
+				c.Assert(t.Root.isKDTree(), check.Equals, true, check.Commentf("Test %d after %d insertions", i, j))
+				c.Check(t.Root.size(), check.Equals, j)
+			}
+		}
+		for j := 1; j <= 1000; j++ {
+			p := test.point(j)
+			_, d := t.Nearest(p)
+			c.Check(d, check.Equals, 0., check.Commentf("Test %d: missing %v", i, p))
+		}
+		t.Balance()
+		c.Check(t.ScapegoatAlpha, check.Equals, test.alpha)
+	}
+}
+
 type compFn func(float64) bool
 
 func left(v float64) bool  { return v <= 0 }
@@ -257,6 +628,248 @@ func (s *S) TestNearest(c *check.C) {
 	}
 }
 
+func (s *S) TestNearestNode(c *check.C) {
+	t := New(append(Points(nil), wpData...), false)
+	for i, q := range append([]Point{
+		{4, 6},
+		{7, 5},
+		{1e5, -1e5},
+		{0, 1e5},
+	}, wpData...) {
+		n, d := t.NearestNode(q)
+		p, pd := t.Nearest(q)
+		c.Assert(n, check.NotNil)
+		c.Check(n.Point, check.DeepEquals, p, check.Commentf("Test %d: query %.3f", i, q))
+		c.Check(d, check.Equals, pd)
+
+		// Replacing the Point with an equal valued copy leaves the tree valid.
+		n.Point = append(Point(nil), n.Point.(Point)...)
+		c.Check(t.Root.isKDTree(), check.Equals, true)
+		c.Check(t.Contains(p), check.Equals, true)
+	}
+	n, d := (&Tree{}).NearestNode(Point{0, 0})
+	c.Check(n, check.IsNil)
+	c.Check(math.IsInf(d, 1), check.Equals, true)
+}
+
+func (s *S) TestRemoveNearest(c *check.C) {
+	var data Points
+	for i := 0; i < 200; i++ {
+		// Coordinates are drawn from a small range to include duplicate points.
+		data = append(data, Point{float64(rand.Intn(20)), float64(rand.Intn(20)), float64(rand.Intn(20))})
+	}
+	for _, bounding := range []bool{false, true} {
+		for i, q := range []Point{{10, 10, 10}, {0, 0, 0}, {-5, 25, 3}} {
+			want := make([]float64, len(data))
+			for j, p := range data {
+				want[j] = q.Distance(p)
+			}
+			sort.Float64s(want)
+
+			t := New(append(Points(nil), data...), bounding)
+			for j, wd := range want {
+				p, d, ok := t.RemoveNearest(q)
+				c.Assert(ok, check.Equals, true)
+				c.Assert(d, check.Equals, wd, check.Commentf("Test %d bounding=%t: removal %d", i, bounding, j))
+				c.Assert(q.Distance(p), check.Equals, d)
+				c.Assert(t.Len(), check.Equals, len(data)-j-1)
+				c.Assert(t.Root.size(), check.Equals, t.Len())
+				c.Assert(t.Root.isSplit(), check.Equals, true, check.Commentf("Test %d: removal %d", i, j))
+				if bounding && t.Root != nil {
+					c.Assert(t.Root.Bounding, check.DeepEquals, t.Bounds(),
+						check.Commentf("Test %d: removal %d", i, j))
+				}
+			}
+			c.Check(t.Root, check.IsNil)
+			p, d, ok := t.RemoveNearest(q)
+			c.Check(p, check.IsNil)
+			c.Check(d, check.Equals, inf)
+			c.Check(ok, check.Equals, false)
+		}
+	}
+
+	// Without duplicate points the tree remains a valid k-d tree
+	// with tight bounding volumes after each removal.
+	p := make(Points, 500)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	for _, bounding := range []bool{false, true} {
+		t := New(append(Points(nil), p...), bounding)
+		remain := make(map[string]bool)
+		for _, e := range p {
+			remain[fmt.Sprint(e)] = true
+		}
+		for j := range p {
+			q := Point{rand.Float64(), rand.Float64(), rand.Float64()}
+			want, wd := t.Nearest(q)
+			got, d, ok := t.RemoveNearest(q)
+			c.Assert(ok, check.Equals, true)
+			c.Check(got, check.DeepEquals, want)
+			c.Check(d, check.Equals, wd)
+			delete(remain, fmt.Sprint(got))
+			c.Assert(t.Root.isKDTree(), check.Equals, true, check.Commentf("bounding=%t: removal %d", bounding, j))
+			if j%50 == 0 {
+				var n int
+				t.Do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+					if remain[fmt.Sprint(c)] {
+						n++
+					}
+					return
+				})
+				c.Check(n, check.Equals, len(remain))
+				c.Check(t.Root.size(), check.Equals, len(remain))
+			}
+		}
+		c.Check(t.Root, check.IsNil)
+	}
+}
+
+// isSplit returns whether every value in the subtree rooted at n is on the correct
+// side of the splitting plane of each of its ancestors, allowing values equal to the
+// ancestor along the plane to be on either side.
+func (n *Node) isSplit() bool {
+	if n == nil {
+		return true
+	}
+	ok := true
+	for _, side := range []struct {
+		ch   *Node
+		sign float64
+	}{{n.Left, 1}, {n.Right, -1}} {
+		if side.ch == nil {
+			continue
+		}
+		side.ch.do(func(c Comparable, _ *Bounding, _ int) (done bool) {
+			if side.sign*c.Compare(n.Point, n.Plane) > 0 {
+				ok = false
+			}
+			return !ok
+		}, 0)
+	}
+	return ok && n.Left.isSplit() && n.Right.isSplit()
+}
+
+// pointBoxDist returns the squared Euclidean distance between p and the volume b.
+func pointBoxDist(p Comparable, b *Bounding) float64 {
+	var d float64
+	for i, v := range p.(Point) {
+		switch {
+		case v < b[0].(Point)[i]:
+			d += (b[0].(Point)[i] - v) * (b[0].(Point)[i] - v)
+		case v > b[1].(Point)[i]:
+			d += (v - b[1].(Point)[i]) * (v - b[1].(Point)[i])
+		}
+	}
+	return d
+}
+
+func (s *S) TestNearestToBounds(c *check.C) {
+	p, d := (&Tree{}).NearestToBounds(&Bounding{Point{0, 0}, Point{1, 1}}, pointBoxDist)
+	c.Check(p, check.IsNil)
+	c.Check(d, check.Equals, inf)
+
+	t := New(append(Points(nil), wpData...), false)
+	for i, test := range []struct {
+		b    *Bounding
+		want Point
+		dist float64
+	}{
+		{&Bounding{Point{3, 3}, Point{6, 5}}, Point{5, 4}, 0},
+		{&Bounding{Point{20, 20}, Point{30, 30}}, Point{9, 6}, 317},
+		{&Bounding{Point{-10, 2}, Point{0, 3}}, Point{2, 3}, 4},
+	} {
+		p, d := t.NearestToBounds(test.b, pointBoxDist)
+		c.Check(p, check.DeepEquals, test.want, check.Commentf("Test %d", i))
+		c.Check(d, check.Equals, test.dist, check.Commentf("Test %d", i))
+	}
+
+	data := make(Points, 1000)
+	for i := range data {
+		data[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t = New(append(Points(nil), data...), false)
+	for i := 0; i < 200; i++ {
+		min := Point{rand.Float64()*3 - 1, rand.Float64()*3 - 1, rand.Float64()*3 - 1}
+		max := Point{min[0] + rand.Float64()*0.2, min[1] + rand.Float64()*0.2, min[2] + rand.Float64()*0.2}
+		b := &Bounding{min, max}
+		want := inf
+		for _, p := range data {
+			want = math.Min(want, pointBoxDist(p, b))
+		}
+		p, d := t.NearestToBounds(b, pointBoxDist)
+		c.Check(d, check.Equals, want, check.Commentf("query %v", b))
+		c.Check(pointBoxDist(p, b), check.Equals, d)
+	}
+}
+
+func (s *S) TestNearestUntil(c *check.C) {
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t := New(append(Points(nil), p...), false)
+	never := func(float64) bool { return false }
+	for i := 0; i < 100; i++ {
+		q := Point{rand.Float64(), rand.Float64(), rand.Float64()}
+		got, d := t.NearestUntil(q, never)
+		want, wd := t.Nearest(q)
+		c.Check(got, check.DeepEquals, want, check.Commentf("Test %d: query %.3f", i, q))
+		c.Check(d, check.Equals, wd)
+
+		const threshold = 0.05
+		var calls int
+		got, d = t.NearestUntil(q, func(d float64) bool { calls++; return d <= threshold })
+		c.Check(d <= threshold || d == wd, check.Equals, true, check.Commentf("Test %d: query %.3f", i, q))
+		c.Check(q.Distance(got), check.Equals, d)
+		c.Check(calls > 0, check.Equals, true)
+	}
+
+	// The search stops at the first point examined if any point is good enough.
+	got, _ := t.NearestUntil(Point{0, 0, 0}, func(float64) bool { return true })
+	c.Check(got, check.DeepEquals, t.Root.Point)
+
+	got, d := (&Tree{}).NearestUntil(Point{0, 0, 0}, never)
+	c.Check(got, check.IsNil)
+	c.Check(math.IsInf(d, 1), check.Equals, true)
+}
+
+func (s *S) TestNearestSubspace(c *check.C) {
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	subDist := func(a, b Point, dims []Dim) float64 {
+		var d float64
+		for _, dim := range dims {
+			d += (a[dim] - b[dim]) * (a[dim] - b[dim])
+		}
+		return d
+	}
+	for _, bounding := range []bool{false, true} {
+		t := New(append(Points(nil), p...), bounding)
+		for _, dims := range [][]Dim{{0}, {1}, {2}, {0, 2}, {1, 2}, {0, 1, 2}} {
+			for i := 0; i < 50; i++ {
+				q := Point{rand.Float64(), rand.Float64(), rand.Float64()}
+				got, d := t.NearestSubspace(q, dims)
+				ed := math.Inf(1)
+				for _, e := range p {
+					ed = math.Min(ed, subDist(q, e, dims))
+				}
+				c.Check(d, check.Equals, ed, check.Commentf("Test %d: dims %v query %.3f", i, dims, q))
+				c.Check(subDist(q, got.(Point), dims), check.Equals, d)
+				if len(dims) == q.Dims() {
+					_, nd := t.Nearest(q)
+					c.Check(d, check.Equals, nd)
+				}
+			}
+		}
+	}
+	got, d := (&Tree{}).NearestSubspace(Point{0, 0, 0}, []Dim{0})
+	c.Check(got, check.IsNil)
+	c.Check(math.IsInf(d, 1), check.Equals, true)
+}
+
 func nearestN(n int, q Point, p Points) []ComparableDist {
 	nk := NewNKeeper(n)
 	for i := 0; i < p.Len(); i++ {
@@ -286,7 +899,7 @@ func (s *S) TestNearestSetN(c *check.C) {
 		{1e5, 0},
 		{0, -1e5},
 		{0, 1e5},
-		{-1e5, 0}}, wpData[:len(wpData)-1]...)
+		{-1e5, 0}}, wpData...)
 	for k := 1; k <= len(wpData); k++ {
 		for i, q := range in {
 			ep := nearestN(k, q, wpData)
@@ -331,6 +944,104 @@ func (s *S) TestNearestSetN(c *check.C) {
 	}
 }
 
+func (s *S) TestClassifyKNN(c *check.C) {
+	centers := map[string]Point{"a": {0, 0}, "b": {10, 0}, "c": {0, 10}}
+	labels := make(map[string]string)
+	var p Points
+	for l, ctr := range centers {
+		for i := 0; i < 20; i++ {
+			pt := Point{ctr[0] + rand.Float64() - 0.5, ctr[1] + rand.Float64() - 0.5}
+			labels[fmt.Sprint(pt)] = l
+			p = append(p, pt)
+		}
+	}
+	labelOf := func(c Comparable) string { return labels[fmt.Sprint(c)] }
+	t := New(p, false)
+	for l, ctr := range centers {
+		for _, k := range []int{1, 5, 15} {
+			got, votes := t.ClassifyKNN(k, Point{ctr[0] + 0.1, ctr[1] - 0.1}, labelOf)
+			c.Check(got, check.Equals, l, check.Commentf("k=%d near %s", k, l))
+			c.Check(votes, check.DeepEquals, map[string]int{l: k})
+		}
+	}
+	got, votes := t.ClassifyKNN(40, Point{1, 1}, labelOf)
+	c.Check(got, check.Equals, "a")
+	c.Check(votes["a"], check.Equals, 20)
+	c.Check(votes["b"]+votes["c"], check.Equals, 20)
+
+	// Ties resolve to the label of the nearest point.
+	t = New(Points{{0, 0}, {1, 0}, {3, 0}, {4, 0}}, false)
+	labelOf = func(c Comparable) string {
+		if c.(Point)[0] < 2 {
+			return "left"
+		}
+		return "right"
+	}
+	got, votes = t.ClassifyKNN(4, Point{2.9, 0}, labelOf)
+	c.Check(got, check.Equals, "right")
+	c.Check(votes, check.DeepEquals, map[string]int{"left": 2, "right": 2})
+	got, _ = t.ClassifyKNN(4, Point{1.1, 0}, labelOf)
+	c.Check(got, check.Equals, "left")
+
+	got, votes = (&Tree{}).ClassifyKNN(3, Point{0, 0}, labelOf)
+	c.Check(got, check.Equals, "")
+	c.Check(votes, check.IsNil)
+}
+
+func (s *S) TestNearestNKeeper(c *check.C) {
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t := New(p, false)
+	for _, n := range []int{1, 5, 10} {
+		keep := NewNKeeper(n)
+		for i := 0; i < 200; i++ {
+			q := Point{rand.Float64(), rand.Float64(), rand.Float64()}
+			want := NewNKeeper(n)
+			t.NearestSet(want, q)
+			t.NearestNKeeper(q, keep)
+			c.Check(keep.Heap, check.DeepEquals, want.Heap, check.Commentf("n=%d query %v", n, q))
+		}
+	}
+
+	// An empty tree leaves only the sentinel.
+	keep := NewNKeeper(3)
+	t.NearestNKeeper(Point{0, 0, 0}, keep)
+	(&Tree{}).NearestNKeeper(Point{0, 0, 0}, keep)
+	c.Check(keep.Heap, check.DeepEquals, Heap{{Dist: inf}})
+}
+
+func (s *S) TestNearestSetNTies(c *check.C) {
+	data := Points{{0, 0}, {1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {-1, -1}, {1, -1}, {-1, 1}, {2, 0}}
+	t := New(append(Points(nil), data...), false)
+	for _, q := range append([]Point{{0, 0}, {0.5, 0.5}, {5, 5}, {-0.5, 0}}, data...) {
+		want := make([]ComparableDist, len(data))
+		for i, p := range data {
+			want[i] = ComparableDist{Comparable: p, Dist: q.Distance(p)}
+		}
+		sort.Slice(want, func(i, j int) bool {
+			if want[i].Dist != want[j].Dist {
+				return want[i].Dist < want[j].Dist
+			}
+			a, b := want[i].Comparable.(Point), want[j].Comparable.(Point)
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			return a[1] < b[1]
+		})
+		for k := 1; k <= len(data); k++ {
+			nk := NewNKeeper(k)
+			t.NearestSet(nk, q)
+			c.Check([]ComparableDist(nk.Heap), check.DeepEquals, want[:k], check.Commentf("k=%d query %v", k, q))
+		}
+		dk := NewDistKeeper(2)
+		t.NearestSet(dk, q)
+		n := sort.Search(len(want), func(i int) bool { return want[i].Dist > 2 })
+		c.Check([]ComparableDist(dk.Heap), check.DeepEquals, want[:n], check.Commentf("query %v", q))
+	}
+}
+
 func (s *S) TestNearestSetDist(c *check.C) {
 	t := New(wpData, false)
 	for i, q := range []Point{
@@ -379,6 +1090,89 @@ func (s *S) TestDo(c *check.C) {
 	c.Check(killed, check.Equals, false)
 }
 
+func (s *S) TestDoLeaves(c *check.C) {
+	var result Points
+	t := New(wpData, false)
+	f := func(c Comparable, _ *Bounding, _ int) (done bool) {
+		result = append(result, c.(Point))
+		return
+	}
+	killed := t.DoLeaves(f)
+	c.Check(result, check.DeepEquals, Points{{2, 3}, {4, 7}, {8, 1}})
+	c.Check(killed, check.Equals, false)
+
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t = New(p, false)
+	var (
+		leaves  Points
+		collect func(*Node)
+	)
+	collect = func(n *Node) {
+		if n == nil {
+			return
+		}
+		if n.Left == nil && n.Right == nil {
+			leaves = append(leaves, n.Point.(Point))
+		}
+		collect(n.Left)
+		collect(n.Right)
+	}
+	collect(t.Root)
+	result = nil
+	t.DoLeaves(f)
+	c.Check(result, check.DeepEquals, leaves)
+
+	result = nil
+	killed = t.DoLeaves(func(c Comparable, _ *Bounding, _ int) (done bool) {
+		result = append(result, c.(Point))
+		return len(result) == 3
+	})
+	c.Check(killed, check.Equals, true)
+	c.Check(result, check.DeepEquals, leaves[:3])
+}
+
+func (s *S) TestDepthHistogram(c *check.C) {
+	c.Check((&Tree{}).DepthHistogram(), check.IsNil)
+
+	p := make(Points, 1000)
+	for i := range p {
+		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+	}
+	t := New(p, false)
+	h := t.DepthHistogram()
+	var leaves, lo, hi int
+	lo = -1
+	for d, n := range h {
+		leaves += n
+		if n != 0 {
+			if lo < 0 {
+				lo = d
+			}
+			hi = d
+		}
+	}
+	var want int
+	t.DoLeaves(func(Comparable, *Bounding, int) (done bool) { want++; return })
+	c.Check(leaves, check.Equals, want)
+	// Pivots are approximate medians, so leaves may span three adjacent depths.
+	c.Check(hi-lo <= 2, check.Equals, true, check.Commentf("balanced tree histogram %v", h))
+
+	// Inserting points in sorted order gives a degenerate tree with a single leaf.
+	t = &Tree{}
+	for i := 0; i < 100; i++ {
+		t.Insert(Point{float64(i), float64(i), float64(i)}, false)
+	}
+	h = t.DepthHistogram()
+	c.Check(h, check.HasLen, 100)
+	c.Check(h[99], check.Equals, 1)
+	for d, n := range h[:99] {
+		c.Check(n, check.Equals, 0, check.Commentf("depth %d", d))
+	}
+}
+
 func (s *S) TestDoBounded(c *check.C) {
 	for _, test := range []struct {
 		bounds *Bounding
@@ -433,12 +1227,260 @@ func (s *S) TestDoBounded(c *check.C) {
 	}
 }
 
-func BenchmarkNew(b *testing.B) {
-	b.StopTimer()
-	p := make(Points, 1e5)
+func (s *S) TestDoBoundedSplitPlane(c *check.C) {
+	// Points equal to a node's point along its plane may be held in
+	// either subtree, so both must be searched when the bound touches
+	// the plane.
+	t := &Tree{
+		Root: &Node{
+			Point: Point{5, 5},
+			Plane: 0,
+			Left:  &Node{Point: Point{5, 2}, Plane: 1},
+			Right: &Node{Point: Point{5, 8}, Plane: 1},
+		},
+		Count: 3,
+	}
+	for _, test := range []struct {
+		bounds *Bounding
+		result Points
+	}{
+		{&Bounding{Point{5, 0}, Point{5, 3}}, Points{{5, 2}}},
+		{&Bounding{Point{5, 7}, Point{5, 9}}, Points{{5, 8}}},
+		{&Bounding{Point{0, 0}, Point{5, 10}}, Points{{5, 2}, {5, 5}, {5, 8}}},
+		{&Bounding{Point{5, 0}, Point{10, 10}}, Points{{5, 2}, {5, 5}, {5, 8}}},
+		{&Bounding{Point{0, 0}, Point{4, 10}}, nil},
+	} {
+		var result Points
+		t.DoBounded(func(c Comparable, _ *Bounding, _ int) (done bool) {
+			result = append(result, c.(Point))
+			return
+		}, test.bounds)
+		c.Check(result, check.DeepEquals, test.result, check.Commentf("bounds %v", test.bounds))
+	}
+
+	var p Points
+	for i := 0; i < 100; i++ {
+		p = append(p, Point{float64(i % 10), float64(i / 10)})
+	}
+	gt := New(append(Points(nil), p...), false)
+	for _, b := range []*Bounding{
+		{Point{3, 3}, Point{3, 3}},
+		{Point{0, 4}, Point{9, 4}},
+		{Point{2, 0}, Point{2, 9}},
+		{Point{2, 3}, Point{6, 7}},
+	} {
+		var want int
+		for _, pt := range p {
+			if b.Contains(pt) {
+				want++
+			}
+		}
+		var got int
+		gt.DoBounded(func(Comparable, *Bounding, int) (done bool) {
+			got++
+			return
+		}, b)
+		c.Check(got, check.Equals, want, check.Commentf("bounds %v", b))
+	}
+}
+
+func (s *S) TestPointsInBox(c *check.C) {
+	for _, test := range []struct {
+		bounds *Bounding
+		result Points
+	}{
+		{
+			&Bounding{Point{0, 0}, Point{10, 10}},
+			wpData,
+		},
+		{
+			&Bounding{Point{3, 4}, Point{10, 10}},
+			Points{Point{5, 4}, Point{4, 7}, Point{9, 6}},
+		},
+		{
+			&Bounding{Point{3, 3}, Point{10, 10}},
+			Points{Point{5, 4}, Point{4, 7}, Point{9, 6}},
+		},
+		{
+			&Bounding{Point{0, 0}, Point{6, 5}},
+			Points{Point{2, 3}, Point{5, 4}},
+		},
+		{
+			&Bounding{Point{5, 2}, Point{7, 4}},
+			Points{Point{5, 4}, Point{7, 2}},
+		},
+		{
+			&Bounding{Point{2, 2}, Point{7, 4}},
+			Points{Point{2, 3}, Point{5, 4}, Point{7, 2}},
+		},
+		{
+			&Bounding{Point{2, 3}, Point{9, 6}},
+			Points{Point{2, 3}, Point{5, 4}, Point{9, 6}},
+		},
+		{
+			&Bounding{Point{7, 2}, Point{7, 2}},
+			Points{Point{7, 2}},
+		},
+		{
+			&Bounding{Point{0, 8}, Point{10, 10}},
+			nil,
+		},
+	} {
+		var result Points
+		t := New(wpData, false)
+		for _, p := range t.PointsInBox(test.bounds[0], test.bounds[1]) {
+			result = append(result, p.(Point))
+		}
+		c.Check(result, check.DeepEquals, test.result)
+	}
+}
+
+func (s *S) TestDoInRegion(c *check.C) {
+	p := make(Points, 1000)
 	for i := range p {
-		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
+		p[i] = Point{rand.Float64(), rand.Float64()}
+	}
+	for _, bounding := range []bool{false, true} {
+		t := New(append(Points(nil), p...), bounding)
+		for _, lim := range []float64{-1, 0.1, 0.5, 1, 1.5, 3} {
+			// The half-space x+y <= lim.
+			var tested int
+			accept := func(c Comparable) bool {
+				tested++
+				pt := c.(Point)
+				return pt[0]+pt[1] <= lim
+			}
+			prune := func(b *Bounding) bool {
+				min := b[0].(Point)
+				return min[0]+min[1] > lim
+			}
+
+			var want []string
+			for _, pt := range p {
+				if pt[0]+pt[1] <= lim {
+					want = append(want, fmt.Sprint(pt))
+				}
+			}
+			sort.Strings(want)
+
+			var got []string
+			done := t.DoInRegion(prune, accept, func(c Comparable) bool {
+				got = append(got, fmt.Sprint(c))
+				return false
+			})
+			c.Check(done, check.Equals, false)
+			sort.Strings(got)
+			c.Check(got, check.DeepEquals, want, check.Commentf("bounding=%t lim=%v", bounding, lim))
+			if bounding && lim < 1 {
+				c.Check(tested < len(p), check.Equals, true, check.Commentf("lim=%v tested=%d", lim, tested))
+			} else if !bounding {
+				c.Check(tested, check.Equals, len(p))
+			}
+
+			if len(want) > 1 {
+				var n int
+				done = t.DoInRegion(prune, accept, func(Comparable) bool {
+					n++
+					return true
+				})
+				c.Check(done, check.Equals, true)
+				c.Check(n, check.Equals, 1)
+			}
+		}
+	}
+	c.Check((&Tree{}).DoInRegion(nil, nil, nil), check.Equals, false)
+}
+
+func (s *S) TestCountDistinctInBounds(c *check.C) {
+	var (
+		p   Points
+		key = make(map[string]int)
+	)
+	for i := 0; i < 100; i++ {
+		pt := Point{float64(i % 10), float64(i / 10)}
+		p = append(p, pt)
+		key[fmt.Sprint(pt)] = i % 7
+	}
+	keyOf := func(c Comparable) interface{} { return key[fmt.Sprint(c)] }
+	t := New(p, false)
+	for _, test := range []struct {
+		b    *Bounding
+		want int
+	}{
+		{nil, 7},
+		{&Bounding{Point{0, 0}, Point{9, 9}}, 7},
+		{&Bounding{Point{0, 0}, Point{2, 0}}, 3},
+		{&Bounding{Point{0, 0}, Point{9, 0}}, 7},
+		{&Bounding{Point{0, 0}, Point{0, 9}}, 7},
+		{&Bounding{Point{0.5, 0.5}, Point{0.6, 0.6}}, 0},
+		{&Bounding{Point{3, 3}, Point{3, 3}}, 1},
+	} {
+		var brute = make(map[interface{}]struct{})
+		for _, pt := range p {
+			if test.b.Contains(pt) {
+				brute[keyOf(pt)] = struct{}{}
+			}
+		}
+		c.Check(len(brute), check.Equals, test.want, check.Commentf("bounds %v", test.b))
+		c.Check(t.CountDistinctInBounds(test.b, keyOf), check.Equals, test.want, check.Commentf("bounds %v", test.b))
+	}
+	c.Check((&Tree{}).CountDistinctInBounds(nil, keyOf), check.Equals, 0)
+}
+
+// benchPoints returns the coordinates in p as Points.
+func (s *S) TestSpatialJoin(c *check.C) {
+	randPoints := func(n int) Points {
+		p := make(Points, n)
+		for i := range p {
+			p[i] = Point{rand.Float64(), rand.Float64()}
+		}
+		return p
 	}
+	type pair struct{ a, b string }
+	for _, r := range []float64{0, 0.001, 0.01, 0.1} {
+		pa, pb := randPoints(200), randPoints(300)
+		want := make(map[pair]float64)
+		for _, a := range pa {
+			for _, b := range pb {
+				if d := a.Distance(b); d <= r {
+					want[pair{fmt.Sprint(a), fmt.Sprint(b)}] = d
+				}
+			}
+		}
+
+		got := make(map[pair]float64)
+		interrupted := SpatialJoin(New(pa, false), New(pb, false), r, func(a, b Comparable, d float64) (done bool) {
+			got[pair{fmt.Sprint(a), fmt.Sprint(b)}] = d
+			return
+		})
+		c.Check(interrupted, check.Equals, false)
+		c.Check(got, check.DeepEquals, want, check.Commentf("radius %v", r))
+	}
+
+	// The join stops when fn returns true.
+	p := randPoints(100)
+	var calls int
+	interrupted := SpatialJoin(New(p, false), New(append(Points(nil), p...), false), 0, func(_, _ Comparable, _ float64) bool {
+		calls++
+		return true
+	})
+	c.Check(interrupted, check.Equals, true)
+	c.Check(calls, check.Equals, 1)
+
+	c.Check(SpatialJoin(&Tree{}, New(p, false), 1, nil), check.Equals, false)
+}
+
+func benchPoints(p [][]float64) Points {
+	b := make(Points, len(p))
+	for i, c := range p {
+		b[i] = c
+	}
+	return b
+}
+
+func BenchmarkNew(b *testing.B) {
+	b.StopTimer()
+	p := benchPoints(testutil.New(1).Points(1e5, 3))
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		_ = New(p, false)
@@ -447,29 +1489,48 @@ func BenchmarkNew(b *testing.B) {
 
 func BenchmarkNewBounds(b *testing.B) {
 	b.StopTimer()
-	p := make(Points, 1e5)
-	for i := range p {
-		p[i] = Point{rand.Float64(), rand.Float64(), rand.Float64()}
-	}
+	p := benchPoints(testutil.New(1).Points(1e5, 3))
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		_ = New(p, true)
 	}
 }
 
+func BenchmarkNewSorted(b *testing.B) {
+	b.StopTimer()
+	p := benchPoints(testutil.New(1).SortedPoints(1e5, 3))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = New(p, false)
+	}
+}
+
+func BenchmarkNewClustered(b *testing.B) {
+	b.StopTimer()
+	p := benchPoints(testutil.New(1).ClusteredPoints(1e5, 3, 10, 0.01))
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = New(p, false)
+	}
+}
+
 func BenchmarkInsert(b *testing.B) {
-	rand.Seed(1)
+	b.StopTimer()
+	p := benchPoints(testutil.New(1).Points(b.N, 3))
 	t := &Tree{}
-	for i := 0; i < b.N; i++ {
-		t.Insert(Point{rand.Float64(), rand.Float64(), rand.Float64()}, false)
+	b.StartTimer()
+	for _, v := range p {
+		t.Insert(v, false)
 	}
 }
 
 func BenchmarkInsertBounds(b *testing.B) {
-	rand.Seed(1)
+	b.StopTimer()
+	p := benchPoints(testutil.New(1).Points(b.N, 3))
 	t := &Tree{}
-	for i := 0; i < b.N; i++ {
-		t.Insert(Point{rand.Float64(), rand.Float64(), rand.Float64()}, true)
+	b.StartTimer()
+	for _, v := range p {
+		t.Insert(v, true)
 	}
 }
 
@@ -494,9 +1555,11 @@ func BenchmarkNearest(b *testing.B) {
 	var (
 		r Comparable
 		d float64
+		q = benchPoints(testutil.New(2).Points(b.N, 3))
 	)
-	for i := 0; i < b.N; i++ {
-		r, d = bTree.Nearest(Point{rand.Float64(), rand.Float64(), rand.Float64()})
+	b.ResetTimer()
+	for _, v := range q {
+		r, d = bTree.Nearest(v)
 	}
 	_, _ = r, d
 }
@@ -505,26 +1568,34 @@ func BenchmarkNearBrute(b *testing.B) {
 	var (
 		r Comparable
 		d float64
+		q = benchPoints(testutil.New(2).Points(b.N, 3))
 	)
-	for i := 0; i < b.N; i++ {
-		r, d = nearest(Point{rand.Float64(), rand.Float64(), rand.Float64()}, bData)
+	b.ResetTimer()
+	for _, v := range q {
+		r, d = nearest(v, bData)
 	}
 	_, _ = r, d
 }
 
 func BenchmarkNearestSetN10(b *testing.B) {
-	var nk = NewNKeeper(10)
-	for i := 0; i < b.N; i++ {
-		bTree.NearestSet(nk, Point{rand.Float64(), rand.Float64(), rand.Float64()})
-		nk.Heap = nk.Heap[:1]
-		nk.Heap[0] = ComparableDist{Comparable: nil, Dist: inf}
+	var (
+		nk = NewNKeeper(10)
+		q  = benchPoints(testutil.New(2).Points(b.N, 3))
+	)
+	b.ResetTimer()
+	for _, v := range q {
+		bTree.NearestNKeeper(v, nk)
 	}
 }
 
 func BenchmarkNearBruteN10(b *testing.B) {
-	var r []ComparableDist
-	for i := 0; i < b.N; i++ {
-		r = nearestN(10, Point{rand.Float64(), rand.Float64(), rand.Float64()}, bData)
+	var (
+		r []ComparableDist
+		q = benchPoints(testutil.New(2).Points(b.N, 3))
+	)
+	b.ResetTimer()
+	for _, v := range q {
+		r = nearestN(10, v, bData)
 	}
 	_ = r
 }
@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"gopkg.in/check.v1"
+
+	"github.com/biogo/store/internal/testutil"
 )
 
 type Ints []int
@@ -105,24 +107,20 @@ func (s *S) TestMedianOfRandoms(c *check.C) {
 }
 
 func BenchmarkMoM(b *testing.B) {
+	src := testutil.New(1)
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		list := make(Ints, 1e4)
-		for i := range list {
-			list[i] = rand.Int()
-		}
+		list := Ints(src.Ints(1e4))
 		b.StartTimer()
 		_ = MedianOfMedians(list)
 	}
 }
 
 func BenchmarkMoMPartition(b *testing.B) {
+	src := testutil.New(1)
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		list := make(Ints, 1e4)
-		for i := range list {
-			list[i] = rand.Int()
-		}
+		list := Ints(src.Ints(1e4))
 		b.StartTimer()
 		p := MedianOfMedians(list)
 		p = Partition(list, p)
@@ -131,10 +129,7 @@ func BenchmarkMoMPartition(b *testing.B) {
 
 func BenchmarkRM(b *testing.B) {
 	b.StopTimer()
-	list := make(Ints, 1e4)
-	for i := range list {
-		list[i] = rand.Int()
-	}
+	list := Ints(testutil.New(1).Ints(1e4))
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		_ = MedianOfRandoms(list, list.Len()/1e3)
@@ -143,10 +138,7 @@ func BenchmarkRM(b *testing.B) {
 
 func BenchmarkRMPartition(b *testing.B) {
 	b.StopTimer()
-	list := make(Ints, 1e4)
-	for i := range list {
-		list[i] = rand.Int()
-	}
+	list := Ints(testutil.New(1).Ints(1e4))
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		p := MedianOfRandoms(list, list.Len()/1e3)
@@ -155,12 +147,10 @@ func BenchmarkRMPartition(b *testing.B) {
 }
 
 func BenchmarkSM(b *testing.B) {
+	src := testutil.New(1)
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		list := make(Ints, 1e4)
-		for i := range list {
-			list[i] = rand.Int()
-		}
+		list := Ints(src.Ints(1e4))
 		b.StartTimer()
 		sort.Sort(list)
 	}
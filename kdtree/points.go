@@ -11,6 +11,8 @@ import (
 var (
 	_ Interface  = Points{}
 	_ Comparable = Point{}
+	_ Interface  = comparables{}
+	_ Interface  = strategic{}
 )
 
 // Randoms is the maximum number of random values to sample for calculation of median of
@@ -79,3 +81,142 @@ func (p Plane) Slice(start, end int) SortSlicer { p.Points = p.Points[start:end]
 func (p Plane) Swap(i, j int) {
 	p.Points[i], p.Points[j] = p.Points[j], p.Points[i]
 }
+
+// comparables is a collection of Comparable values that satisfies the Interface and
+// the Bounder interface. It is used to rebuild a Tree from its stored points.
+type comparables []Comparable
+
+// Bounds returns the bounding volume of the collection. If any of the elements is not
+// an Extender, the bounding volume is determined using only Compare by extremaBounds.
+func (p comparables) Bounds() *Bounding {
+	var b *Bounding
+	for _, c := range p {
+		e, ok := c.(Extender)
+		if !ok {
+			return extremaBounds(p)
+		}
+		b = e.Extend(b)
+	}
+	return b
+}
+
+// A corner is a Comparable representing a corner of a bounding volume. Each dimension of
+// the corner is represented by the Comparable holding the extreme value along it.
+type corner []Comparable
+
+func (c corner) Compare(b Comparable, d Dim) float64 {
+	if b, ok := b.(corner); ok {
+		return c[d].Compare(b[d], d)
+	}
+	return c[d].Compare(b, d)
+}
+func (c corner) Dims() int { return len(c) }
+func (c corner) Distance(b Comparable) float64 {
+	var sum float64
+	for d := range c {
+		v := c.Compare(b, Dim(d))
+		sum += v * v
+	}
+	return sum
+}
+
+// extremaBounds returns the tight bounding volume of the values in p, determined using
+// only Compare. The corners of the returned Bounding are not of the same type as the
+// values in p, so it must not be passed to an Extender's Extend method. Corners in p
+// contribute the values they hold. If p is empty, extremaBounds returns nil.
+func extremaBounds(p []Comparable) *Bounding {
+	if len(p) == 0 {
+		return nil
+	}
+	dims := p[0].Dims()
+	min := make(corner, dims)
+	max := make(corner, dims)
+	for i, c := range p {
+		for d := range min {
+			v := c
+			if cc, ok := c.(corner); ok {
+				v = cc[d]
+			}
+			if i == 0 {
+				min[d], max[d] = v, v
+				continue
+			}
+			if v.Compare(min[d], Dim(d)) < 0 {
+				min[d] = v
+			}
+			if v.Compare(max[d], Dim(d)) > 0 {
+				max[d] = v
+			}
+		}
+	}
+	return &Bounding{min, max}
+}
+func (p comparables) Index(i int) Comparable         { return p[i] }
+func (p comparables) Len() int                       { return len(p) }
+func (p comparables) Pivot(d Dim) int                { return comparablePlane{comparables: p, Dim: d}.Pivot() }
+func (p comparables) Slice(start, end int) Interface { return p[start:end] }
+
+// A comparablePlane is a wrapping type that allows a comparables type be pivoted on a dimension.
+type comparablePlane struct {
+	Dim
+	comparables
+}
+
+func (p comparablePlane) Less(i, j int) bool {
+	return p.comparables[i].Compare(p.comparables[j], p.Dim) < 0
+}
+func (p comparablePlane) Pivot() int {
+	m := p.Len() / 2
+	Select(p, m)
+	return Partition(p, m)
+}
+func (p comparablePlane) Slice(start, end int) SortSlicer {
+	p.comparables = p.comparables[start:end]
+	return p
+}
+func (p comparablePlane) Swap(i, j int) {
+	p.comparables[i], p.comparables[j] = p.comparables[j], p.comparables[i]
+}
+
+// A PivotStrategy specifies how the pivot of a collection of points is chosen when
+// building a tree.
+type PivotStrategy int
+
+const (
+	// PivotMedianOfRandoms pivots on the median of up to Randoms randomly chosen
+	// points, as is done by Points.
+	PivotMedianOfRandoms PivotStrategy = iota
+
+	// PivotMedianOfMedians pivots on the median of the medians of groups of five
+	// points.
+	PivotMedianOfMedians
+
+	// PivotMedian pivots on the exact median. Trees built from points with distinct
+	// coordinates using PivotMedian have a structure that does not depend on the
+	// order of the points.
+	PivotMedian
+)
+
+// strategic is a collection of Comparable values that satisfies the Interface and the
+// Bounder interface, pivoting according to a PivotStrategy.
+type strategic struct {
+	comparables
+	strategy PivotStrategy
+}
+
+func (p strategic) Pivot(d Dim) int {
+	pl := comparablePlane{comparables: p.comparables, Dim: d}
+	switch p.strategy {
+	case PivotMedianOfRandoms:
+		return Partition(pl, MedianOfRandoms(pl, Randoms))
+	case PivotMedianOfMedians:
+		return Partition(pl, MedianOfMedians(pl))
+	case PivotMedian:
+		return pl.Pivot()
+	}
+	panic("kdtree: unknown pivot strategy")
+}
+func (p strategic) Slice(start, end int) Interface {
+	p.comparables = p.comparables[start:end]
+	return p
+}
@@ -11,6 +11,10 @@
 //  http://www.teachsolaisgames.com/articles/balanced_left_leaning.html
 package llrb
 
+import (
+	"container/heap"
+)
+
 const (
 	TD234 = iota
 	BU23
@@ -36,9 +40,27 @@ type Comparable interface {
 	//  c == 0 if a == b; and
 	//  c > 0 if a > b.
 	//
+	// Only the sign of c is used by the tree. Implementations over integer types
+	// should not return the difference of the two values, a - b, since this
+	// overflows for operands of large magnitude, giving a result with the wrong
+	// sign and silently corrupting the tree. CompareInt provides an
+	// overflow-safe comparison.
 	Compare(Comparable) int
 }
 
+// CompareInt returns -1, 0 or 1 if a is less than, equal to or greater than b
+// respectively. It is intended for use in Compare methods of integer based
+// Comparables, in place of a - b, which may overflow.
+func CompareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
 // A Color represents the color of a Node.
 type Color bool
 
@@ -168,6 +190,58 @@ func (t *Tree) Get(q Comparable) Comparable {
 	return n.Elem
 }
 
+// GetAll returns all the values in the Tree that match q according to q.Compare(), in sort
+// order. If insertion without replacement has been used, values that match q are returned in
+// the order defined by their own Compare methods; for GetAll to return matches in insertion
+// order, stored values must break ties using a secondary key that increases with insertion.
+func (t *Tree) GetAll(q Comparable) []Comparable {
+	var o []Comparable
+	t.DoMatching(func(e Comparable) (done bool) { o = append(o, e); return }, q)
+	return o
+}
+
+// IndexOf returns the zero-based position in sort order of the first value in the Tree that
+// matches q according to q.Compare(), and whether a match was found. Nodes do not hold subtree
+// sizes, so IndexOf is O(n) in the number of values preceding the match.
+func (t *Tree) IndexOf(q Comparable) (index int, ok bool) {
+	if t.Root == nil {
+		return 0, false
+	}
+	t.Root.do(func(e Comparable) (done bool) {
+		switch c := q.Compare(e); {
+		case c == 0:
+			ok = true
+			return true
+		case c < 0:
+			return true
+		}
+		index++
+		return
+	})
+	if !ok {
+		return 0, false
+	}
+	return index, true
+}
+
+// At returns the value at the zero-based position index in sort order, and whether index is
+// within the range of the Tree. Nodes do not hold subtree sizes, so At is O(index).
+func (t *Tree) At(index int) (e Comparable, ok bool) {
+	if index < 0 || index >= t.Count {
+		return nil, false
+	}
+	i := 0
+	t.Root.do(func(c Comparable) (done bool) {
+		if i == index {
+			e, ok = c, true
+			return true
+		}
+		i++
+		return
+	})
+	return e, ok
+}
+
 func (n *Node) search(q Comparable) *Node {
 	for n != nil {
 		switch c := q.Compare(n.Elem); {
@@ -297,6 +371,170 @@ func (n *Node) deleteMax() (root *Node, d int) {
 	return
 }
 
+// DeleteMinOK deletes the node with the minimum value in the tree in the same way as
+// DeleteMin, returning whether a node was deleted. DeleteMinOK returns false if the
+// tree was empty.
+func (t *Tree) DeleteMinOK() bool {
+	if t.Root == nil {
+		return false
+	}
+	t.DeleteMin()
+	return true
+}
+
+// DeleteMaxOK deletes the node with the maximum value in the tree in the same way as
+// DeleteMax, returning whether a node was deleted. DeleteMaxOK returns false if the
+// tree was empty.
+func (t *Tree) DeleteMaxOK() bool {
+	if t.Root == nil {
+		return false
+	}
+	t.DeleteMax()
+	return true
+}
+
+// DeleteMinN deletes up to n nodes with the minimum values in the tree, returning the
+// deleted values in ascending sort order. If n is greater than or equal to the number
+// of values stored, the tree is emptied. When n is small relative to the number of values
+// stored, the values are deleted one at a time with DeleteMin at a cost of O(n log Count);
+// otherwise the tree is rebuilt from the remaining values in a single O(Count) pass.
+func (t *Tree) DeleteMinN(n int) []Comparable {
+	if t.Root == nil || n <= 0 {
+		return nil
+	}
+	if deleteEach(n, t.Count) {
+		o := make([]Comparable, n)
+		for i := range o {
+			o[i] = t.Min()
+			t.DeleteMin()
+		}
+		return o
+	}
+	e := make([]Comparable, 0, t.Count)
+	t.Root.do(func(c Comparable) (done bool) { e = append(e, c); return })
+	if n >= len(e) {
+		*t = Tree{}
+		return e
+	}
+	o := append([]Comparable(nil), e[:n]...)
+	t.Root = buildSorted(e[n:])
+	t.Count = len(e) - n
+	return o
+}
+
+// DeleteMaxN deletes up to n nodes with the maximum values in the tree, returning the
+// deleted values in descending sort order. If n is greater than or equal to the number
+// of values stored, the tree is emptied. When n is small relative to the number of values
+// stored, the values are deleted one at a time with DeleteMax at a cost of O(n log Count);
+// otherwise the tree is rebuilt from the remaining values in a single O(Count) pass.
+func (t *Tree) DeleteMaxN(n int) []Comparable {
+	if t.Root == nil || n <= 0 {
+		return nil
+	}
+	if deleteEach(n, t.Count) {
+		o := make([]Comparable, n)
+		for i := range o {
+			o[i] = t.Max()
+			t.DeleteMax()
+		}
+		return o
+	}
+	e := make([]Comparable, 0, t.Count)
+	t.Root.do(func(c Comparable) (done bool) { e = append(e, c); return })
+	if n > len(e) {
+		n = len(e)
+	}
+	o := make([]Comparable, n)
+	for i := range o {
+		o[i] = e[len(e)-1-i]
+	}
+	if n == len(e) {
+		*t = Tree{}
+		return o
+	}
+	t.Root = buildSorted(e[:len(e)-n])
+	t.Count = len(e) - n
+	return o
+}
+
+// deleteEach returns whether deleting n of count values one at a time is expected to be
+// cheaper than rebuilding the tree, that is whether n*log2(count) < count.
+func deleteEach(n, count int) bool {
+	if n >= count {
+		return false
+	}
+	lg := 0
+	for c := count; c > 1; c >>= 1 {
+		lg++
+	}
+	return n*lg < count
+}
+
+// Rebalance rebuilds the tree from its values in sort order, giving a valid LLRB tree of
+// near minimal height. The stored values must be in sort order under an in-order traversal,
+// but the shape and coloring of the tree are otherwise ignored, so Rebalance can be used to
+// repair trees that have been constructed by hand. Count is set to the number of values
+// stored.
+func (t *Tree) Rebalance() {
+	if t.Root == nil {
+		t.Count = 0
+		return
+	}
+	var e []Comparable
+	t.Root.do(func(c Comparable) (done bool) { e = append(e, c); return })
+	t.Root = buildSorted(e)
+	t.Count = len(e)
+}
+
+// buildSorted returns the root of a valid LLRB tree of near minimal height holding the
+// sorted values in e.
+func buildSorted(e []Comparable) *Node {
+	black := 0
+	for n := len(e) + 1; n > 1; n >>= 1 {
+		black++
+	}
+	return build(e, black)
+}
+
+// build returns the root of a valid LLRB tree holding the sorted values in e with the
+// specified black height. The number of values in e must be within [2^black-1, 3^black-1].
+// 2-nodes are preferred over 3-nodes so that 3-nodes are pushed to the bottom of the tree.
+func build(e []Comparable, black int) *Node {
+	if black == 0 {
+		return nil
+	}
+	var lo, hi = 1, 1
+	for i := 1; i < black; i++ {
+		lo *= 2
+		hi *= 3
+	}
+	lo--
+	hi--
+	n := len(e)
+	if n-1 <= 2*hi {
+		l := (n - 1) / 2
+		return &Node{
+			Elem:  e[l],
+			Left:  build(e[:l], black-1),
+			Right: build(e[l+1:], black-1),
+			Color: Black,
+		}
+	}
+	l := (n - 2) / 3
+	m := l + 1 + (n-2-l)/2
+	return &Node{
+		Elem: e[m],
+		Left: &Node{
+			Elem:  e[l],
+			Left:  build(e[:l], black-1),
+			Right: build(e[l+1:m], black-1),
+			Color: Red,
+		},
+		Right: build(e[m+1:], black-1),
+		Color: Black,
+	}
+}
+
 // Delete deletes the node that matches e according to Compare(). Note that Compare must
 // identify the target node uniquely and in cases where non-unique keys are used,
 // attributes used to break ties must be used to determine tree ordering during insertion.
@@ -346,6 +584,24 @@ func (n *Node) delete(e Comparable) (root *Node, d int) {
 	return
 }
 
+// DeleteFunc deletes all values in the Tree for which pred returns true and returns the number
+// of values deleted. Matching values are collected before any deletion is made, so pred is
+// called on each stored value exactly once.
+func (t *Tree) DeleteFunc(pred func(Comparable) bool) int {
+	var del []Comparable
+	t.Do(func(e Comparable) (done bool) {
+		if pred(e) {
+			del = append(del, e)
+		}
+		return
+	})
+	n := t.Count
+	for _, e := range del {
+		t.Delete(e)
+	}
+	return n - t.Count
+}
+
 // Return the minimum value stored in the tree. This will be the left-most minimum value if
 // insertion without replacement has been used.
 func (t *Tree) Min() Comparable {
@@ -434,6 +690,76 @@ func (n *Node) ceil(q Comparable) *Node {
 	return n
 }
 
+// GetWith returns the first value in the Tree matched by cmp, which must return the sort order
+// relationship between the query and the stored value passed to it, in the same manner as
+// q.Compare(stored). This allows queries with asymmetric comparison semantics, such as half-open
+// boundary lookups, to be made without a special purpose Comparable. If cmp is nil, q.Compare
+// is used.
+func (t *Tree) GetWith(q Comparable, cmp func(stored Comparable) int) Comparable {
+	if cmp == nil {
+		cmp = q.Compare
+	}
+	for n := t.Root; n != nil; {
+		switch c := cmp(n.Elem); {
+		case c == 0:
+			return n.Elem
+		case c < 0:
+			n = n.Left
+		default:
+			n = n.Right
+		}
+	}
+	return nil
+}
+
+// FloorWith returns the greatest value equal to or less than the query according to cmp, which
+// is interpreted as for GetWith. If cmp never returns zero, FloorWith returns the greatest value
+// less than the query. If cmp is nil, q.Compare is used.
+func (t *Tree) FloorWith(q Comparable, cmp func(stored Comparable) int) Comparable {
+	if cmp == nil {
+		cmp = q.Compare
+	}
+	var f *Node
+	for n := t.Root; n != nil; {
+		switch c := cmp(n.Elem); {
+		case c == 0:
+			return n.Elem
+		case c < 0:
+			n = n.Left
+		default:
+			f, n = n, n.Right
+		}
+	}
+	if f == nil {
+		return nil
+	}
+	return f.Elem
+}
+
+// CeilWith returns the smallest value equal to or greater than the query according to cmp, which
+// is interpreted as for GetWith. If cmp never returns zero, CeilWith returns the smallest value
+// greater than the query. If cmp is nil, q.Compare is used.
+func (t *Tree) CeilWith(q Comparable, cmp func(stored Comparable) int) Comparable {
+	if cmp == nil {
+		cmp = q.Compare
+	}
+	var f *Node
+	for n := t.Root; n != nil; {
+		switch c := cmp(n.Elem); {
+		case c == 0:
+			return n.Elem
+		case c > 0:
+			n = n.Right
+		default:
+			f, n = n, n.Left
+		}
+	}
+	if f == nil {
+		return nil
+	}
+	return f.Elem
+}
+
 // An Operation is a function that operates on a Comparable. If done is returned true, the
 // Operation is indicating that no further work needs to be done and so the Do function should
 // traverse no further.
@@ -493,6 +819,28 @@ func (n *Node) doReverse(fn Operation) (done bool) {
 	return
 }
 
+// Fold performs f on all values stored in the tree in sort order, threading an accumulator
+// through the traversal. The accumulator is initialised to init and replaced by the value
+// returned by each call to f. The final accumulator value is returned. If f alters stored
+// values' sort relationships, future tree operation behaviors are undefined.
+func (t *Tree) Fold(init interface{}, f func(acc interface{}, e Comparable) interface{}) interface{} {
+	if t.Root == nil {
+		return init
+	}
+	return t.Root.fold(init, f)
+}
+
+func (n *Node) fold(acc interface{}, f func(acc interface{}, e Comparable) interface{}) interface{} {
+	if n.Left != nil {
+		acc = n.Left.fold(acc, f)
+	}
+	acc = f(acc, n.Elem)
+	if n.Right != nil {
+		acc = n.Right.fold(acc, f)
+	}
+	return acc
+}
+
 // DoRange performs fn on all values stored in the tree over the interval [from, to) from left
 // to right. If to is less than from DoRange will panic. A boolean is returned indicating whether
 // the Do traversal was interrupted by an Operation returning true. If fn alters stored values'
@@ -527,6 +875,33 @@ func (n *Node) doRange(fn Operation, lo, hi Comparable) (done bool) {
 	return
 }
 
+// RangeFold performs f on all values stored in the tree over the interval [from, to) in sort
+// order, threading an accumulator through the traversal in the same way as Fold. The traversal
+// is pruned using the range bounds. If to is less than from RangeFold will panic.
+func (t *Tree) RangeFold(from, to Comparable, init interface{}, f func(acc interface{}, e Comparable) interface{}) interface{} {
+	if from.Compare(to) > 0 {
+		panic("llrb: inverted range")
+	}
+	if t.Root == nil {
+		return init
+	}
+	return t.Root.rangeFold(from, to, init, f)
+}
+
+func (n *Node) rangeFold(lo, hi Comparable, acc interface{}, f func(acc interface{}, e Comparable) interface{}) interface{} {
+	lc, hc := lo.Compare(n.Elem), hi.Compare(n.Elem)
+	if lc <= 0 && n.Left != nil {
+		acc = n.Left.rangeFold(lo, hi, acc, f)
+	}
+	if lc <= 0 && hc > 0 {
+		acc = f(acc, n.Elem)
+	}
+	if hc > 0 && n.Right != nil {
+		acc = n.Right.rangeFold(lo, hi, acc, f)
+	}
+	return acc
+}
+
 // DoRangeReverse performs fn on all values stored in the tree over the interval (to, from] from
 // right to left. If from is less than to DoRange will panic. A boolean is returned indicating
 // whether the Do traversal was interrupted by an Operation returning true. If fn alters stored
@@ -593,3 +968,72 @@ func (n *Node) doMatch(fn Operation, q Comparable) (done bool) {
 	}
 	return
 }
+
+// MergeTrees performs fn on all values stored in trees in their combined sort order without
+// constructing the union of the trees. Values that compare equal are visited in the order of
+// the trees holding them. A boolean is returned indicating whether the traversal was
+// interrupted by an Operation returning true. If fn alters stored values' sort relationships
+// or any of the trees are altered during the traversal, behavior is undefined.
+func MergeTrees(fn Operation, trees ...*Tree) bool {
+	h := make(cursorHeap, 0, len(trees))
+	for i, t := range trees {
+		if t == nil || t.Root == nil {
+			continue
+		}
+		c := &cursor{idx: i}
+		c.pushLeft(t.Root)
+		h = append(h, c)
+	}
+	heap.Init(&h)
+	for len(h) != 0 {
+		c := h[0]
+		if fn(c.next()) {
+			return true
+		}
+		if len(c.stack) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return false
+}
+
+// cursor is an in-order iterator over the nodes of a tree.
+type cursor struct {
+	idx   int
+	stack []*Node
+}
+
+func (c *cursor) pushLeft(n *Node) {
+	for ; n != nil; n = n.Left {
+		c.stack = append(c.stack, n)
+	}
+}
+
+func (c *cursor) peek() Comparable { return c.stack[len(c.stack)-1].Elem }
+
+func (c *cursor) next() Comparable {
+	n := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	c.pushLeft(n.Right)
+	return n.Elem
+}
+
+// cursorHeap is a min-heap of cursors ordered by their next value.
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int { return len(h) }
+func (h cursorHeap) Less(i, j int) bool {
+	c := h[i].peek().Compare(h[j].peek())
+	return c < 0 || (c == 0 && h[i].idx < h[j].idx)
+}
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	c := old[n]
+	*h = old[:n]
+	return c
+}
@@ -15,6 +15,8 @@ import (
 	"unsafe"
 
 	"gopkg.in/check.v1"
+
+	"github.com/biogo/store/internal/testutil"
 )
 
 var (
@@ -112,6 +114,18 @@ func (n *Node) isBalanced(black int) bool {
 	return n.Left.isBalanced(black) && n.Right.isBalanced(black)
 }
 
+// How many nodes are on the longest path from the root to a leaf?
+func (n *Node) height() int {
+	if n == nil {
+		return 0
+	}
+	l, r := n.Left.height(), n.Right.height()
+	if l > r {
+		return l + 1
+	}
+	return r + 1
+}
+
 // Test helpers
 
 type compRune rune
@@ -261,6 +275,59 @@ func (s *S) SetUpSuite(c *check.C) {
 	fmt.Printf("Testing %s Left-Leaning Red Black Tree package.\n", mode[Mode])
 }
 
+type safeInt int
+
+func (i safeInt) Compare(b Comparable) int { return CompareInt(int(i), int(b.(safeInt))) }
+
+func (s *S) TestCompareInt(c *check.C) {
+	const (
+		maxInt = int(^uint(0) >> 1)
+		minInt = -maxInt - 1
+	)
+	// Naive subtraction gives the wrong sign at the extremes.
+	c.Check(compInt(minInt).Compare(compInt(maxInt)) < 0, check.Equals, false)
+	c.Check(compInt(maxInt).Compare(compInt(minInt)) > 0, check.Equals, false)
+
+	for _, test := range []struct {
+		a, b int
+		want int
+	}{
+		{minInt, maxInt, -1},
+		{maxInt, minInt, 1},
+		{minInt, minInt, 0},
+		{maxInt, maxInt, 0},
+		{-1, 0, -1},
+		{0, -1, 1},
+		{minInt, 1, -1},
+		{maxInt, -1, 1},
+	} {
+		c.Check(CompareInt(test.a, test.b), check.Equals, test.want, check.Commentf("%d vs %d", test.a, test.b))
+	}
+
+	t := &Tree{}
+	values := []safeInt{safeInt(maxInt), safeInt(minInt), 0, safeInt(maxInt - 1), safeInt(minInt + 1), -1, 1, safeInt(maxInt / 2), safeInt(minInt / 2)}
+	for _, v := range values {
+		t.Insert(v)
+	}
+	c.Check(t.Len(), check.Equals, len(values))
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+	c.Check(t.Min(), check.Equals, safeInt(minInt))
+	c.Check(t.Max(), check.Equals, safeInt(maxInt))
+	var last Comparable
+	t.Do(func(e Comparable) (done bool) {
+		if last != nil {
+			c.Check(last.(safeInt) < e.(safeInt), check.Equals, true)
+		}
+		last = e
+		return
+	})
+	for _, v := range values {
+		c.Check(t.Get(v), check.Equals, v)
+	}
+}
+
 func (s *S) TestMakeAndDescribeTree(c *check.C) {
 	c.Check(describeTree((*Node)(nil), true, false), check.Equals, "();")
 	for _, desc := range []string{
@@ -384,6 +451,33 @@ func (s *S) TestDeletion(c *check.C) {
 	c.Check(*t, check.Equals, Tree{})
 }
 
+func (s *S) TestDeleteFunc(c *check.C) {
+	t := &Tree{}
+	c.Check(t.DeleteFunc(func(Comparable) bool { return true }), check.Equals, 0)
+	for i := 0; i < 1000; i++ {
+		t.Insert(compInt(i))
+	}
+	n := t.DeleteFunc(func(e Comparable) bool { return e.(compInt)%2 == 0 })
+	c.Check(n, check.Equals, 500)
+	c.Check(t.Len(), check.Equals, 500)
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+	var want, got compInts
+	for i := 1; i < 1000; i += 2 {
+		want = append(want, compInt(i))
+	}
+	t.Do(func(e Comparable) (done bool) {
+		got = append(got, e.(compInt))
+		return
+	})
+	c.Check(got, check.DeepEquals, want)
+
+	c.Check(t.DeleteFunc(func(Comparable) bool { return false }), check.Equals, 0)
+	c.Check(t.DeleteFunc(func(Comparable) bool { return true }), check.Equals, 500)
+	c.Check(*t, check.Equals, Tree{})
+}
+
 func (s *S) TestGet(c *check.C) {
 	min, max := compRune(0), compRune(100000)
 	t := &Tree{}
@@ -401,6 +495,85 @@ func (s *S) TestGet(c *check.C) {
 	}
 }
 
+// seqElem is a Comparable that orders equal keys by insertion sequence.
+type seqElem struct {
+	key, seq int
+}
+
+func (e seqElem) Compare(b Comparable) int {
+	o := b.(seqElem)
+	if c := CompareInt(e.key, o.key); c != 0 {
+		return c
+	}
+	return CompareInt(e.seq, o.seq)
+}
+
+// seqKey is a query that matches all seqElems with an equal key.
+type seqKey int
+
+func (k seqKey) Compare(b Comparable) int { return CompareInt(int(k), b.(seqElem).key) }
+
+func (s *S) TestGetAll(c *check.C) {
+	t := &Tree{}
+	var seq int
+	for _, k := range rand.Perm(100) {
+		for i := 0; i <= k%5; i++ {
+			t.Insert(seqElem{key: k, seq: seq})
+			seq++
+		}
+	}
+	c.Check(t.Len(), check.Equals, seq)
+	for k := 0; k < 100; k++ {
+		all := t.GetAll(seqKey(k))
+		c.Check(len(all), check.Equals, k%5+1, check.Commentf("key %d", k))
+		for i, e := range all {
+			c.Check(e.(seqElem).key, check.Equals, k)
+			if i > 0 {
+				c.Check(e.(seqElem).seq > all[i-1].(seqElem).seq, check.Equals, true)
+			}
+		}
+	}
+	c.Check(t.GetAll(seqKey(-1)), check.IsNil)
+	c.Check((&Tree{}).GetAll(seqKey(0)), check.IsNil)
+}
+
+func (s *S) TestIndexOfAt(c *check.C) {
+	t := &Tree{}
+	_, ok := t.IndexOf(compInt(0))
+	c.Check(ok, check.Equals, false)
+	_, ok = t.At(0)
+	c.Check(ok, check.Equals, false)
+
+	for _, i := range rand.Perm(500) {
+		t.Insert(compInt(i * 2))
+	}
+	for i := 0; i < t.Len(); i++ {
+		e, ok := t.At(i)
+		c.Assert(ok, check.Equals, true)
+		c.Check(e, check.Equals, compInt(i*2))
+		idx, ok := t.IndexOf(e)
+		c.Check(ok, check.Equals, true)
+		c.Check(idx, check.Equals, i)
+	}
+	for _, q := range []compInt{-1, 1, 501, 999, 1000} {
+		_, ok := t.IndexOf(q)
+		c.Check(ok, check.Equals, false, check.Commentf("query %d", q))
+	}
+	for _, i := range []int{-1, 500} {
+		_, ok := t.At(i)
+		c.Check(ok, check.Equals, false, check.Commentf("index %d", i))
+	}
+
+	// IndexOf returns the position of the first match.
+	t = &Tree{}
+	for i, k := range []int{3, 1, 2, 2, 2, 0} {
+		t.Insert(seqElem{key: k, seq: i})
+	}
+	idx, ok := t.IndexOf(seqKey(2))
+	c.Check(ok, check.Equals, true)
+	c.Check(idx, check.Equals, 2)
+}
+
 func (s *S) TestFloor(c *check.C) {
 	min, max := compRune(0), compRune(100000)
 	t := &Tree{}
@@ -455,6 +628,36 @@ func (s *S) TestUpper(c *check.C) {
 	c.Check(t.Ceil(compIntUpper(max+1)), check.Equals, Comparable(nil))
 }
 
+func (s *S) TestGetWith(c *check.C) {
+	min, max := 0, 1000
+	t := &Tree{}
+	for _, f := range []func(q Comparable, cmp func(Comparable) int) Comparable{t.GetWith, t.FloorWith, t.CeilWith} {
+		c.Check(f(compInt(0), nil), check.Equals, Comparable(nil))
+	}
+	for i := min; i <= max; i++ {
+		if i&1 == 1 { // Insert odd numbers only.
+			t.Insert(compInt(i))
+		}
+	}
+	for i := min - 2; i < max+2; i++ {
+		exact := func(stored Comparable) int { return i - int(stored.(compInt)) }
+		upper := func(stored Comparable) int {
+			if d := exact(stored); d != 0 {
+				return d
+			}
+			return 1
+		}
+		c.Check(t.GetWith(nil, exact), check.Equals, t.Get(compInt(i)))
+		c.Check(t.GetWith(compInt(i), nil), check.Equals, t.Get(compInt(i)))
+		c.Check(t.GetWith(nil, upper), check.Equals, Comparable(nil))
+		c.Check(t.FloorWith(nil, exact), check.Equals, t.Floor(compInt(i)))
+		c.Check(t.FloorWith(nil, upper), check.Equals, t.Floor(compIntUpper(i)))
+		c.Check(t.CeilWith(nil, exact), check.Equals, t.Ceil(compInt(i)))
+		c.Check(t.CeilWith(nil, upper), check.Equals, t.Ceil(compIntUpper(i)))
+		c.Check(t.CeilWith(compIntUpper(i), nil), check.Equals, t.Ceil(compIntUpper(i)))
+	}
+}
+
 func (s *S) TestRandomlyInsertedGet(c *check.C) {
 	count, max := 100000, 1000
 	t := &Tree{}
@@ -648,6 +851,167 @@ func (s *S) TestDeleteMinMax(c *check.C) {
 	}
 }
 
+func (s *S) TestDeleteMinMaxOK(c *check.C) {
+	for _, test := range []struct {
+		name string
+		del  func(*Tree) bool
+		next func(*Tree) Comparable
+	}{
+		{"DeleteMinOK", (*Tree).DeleteMinOK, (*Tree).Min},
+		{"DeleteMaxOK", (*Tree).DeleteMaxOK, (*Tree).Max},
+	} {
+		t := &Tree{}
+		c.Check(test.del(t), check.Equals, false, check.Commentf("%s on empty tree", test.name))
+		for _, i := range rand.Perm(100) {
+			t.Insert(compInt(i))
+		}
+		n := t.Len()
+		var deleted int
+		for {
+			want := test.next(t)
+			if !test.del(t) {
+				break
+			}
+			c.Check(t.Get(want), check.IsNil, check.Commentf("%s deletion %d", test.name, deleted))
+			deleted++
+			c.Check(t.Len(), check.Equals, n-deleted)
+		}
+		c.Check(deleted, check.Equals, n, check.Commentf("%s", test.name))
+		c.Check(t.Root, check.IsNil)
+		c.Check(test.del(t), check.Equals, false, check.Commentf("%s on drained tree", test.name))
+	}
+}
+
+func (s *S) TestDeleteMinMaxN(c *check.C) {
+	var (
+		min, max = compInt(0), compInt(1000)
+		t        = &Tree{}
+	)
+	for _, i := range rand.Perm(int(max - min)) {
+		t.Insert(compInt(i) + min)
+	}
+	c.Assert(t.Len(), check.Equals, int(max-min))
+
+	o := t.DeleteMinN(100)
+	c.Check(len(o), check.Equals, 100)
+	for i, e := range o {
+		c.Check(e, check.Equals, min+compInt(i))
+	}
+	c.Check(t.Len(), check.Equals, int(max-min)-100)
+	c.Check(t.Min(), check.Equals, min+100)
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+
+	o = t.DeleteMaxN(100)
+	c.Check(len(o), check.Equals, 100)
+	for i, e := range o {
+		c.Check(e, check.Equals, max-1-compInt(i))
+	}
+	c.Check(t.Len(), check.Equals, int(max-min)-200)
+	c.Check(t.Max(), check.Equals, max-101)
+	c.Check(t.isBST(), check.Equals, true)
+	c.Check(t.is23_234(), check.Equals, true)
+	c.Check(t.isBalanced(), check.Equals, true)
+
+	c.Check(t.DeleteMinN(0), check.IsNil)
+	o = t.DeleteMaxN(t.Len() + 1)
+	c.Check(len(o), check.Equals, int(max-min)-200)
+	c.Check(o[0], check.Equals, max-101)
+	c.Check(o[len(o)-1], check.Equals, min+100)
+	c.Check(*t, check.Equals, Tree{})
+	c.Check(t.DeleteMinN(1), check.IsNil)
+
+	// The first DeleteMinN above deletes one value at a time
+	// and the DeleteMaxN following it rebuilds the tree.
+	c.Check(deleteEach(100, 1000), check.Equals, true)
+	c.Check(deleteEach(100, 900), check.Equals, false)
+	c.Check(deleteEach(1, 1), check.Equals, false)
+
+	for size := 1; size <= 40; size++ {
+		for n := 1; n <= size; n++ {
+			for _, max := range []bool{false, true} {
+				t := &Tree{}
+				for _, i := range rand.Perm(size) {
+					t.Insert(compInt(i))
+				}
+				var o []Comparable
+				if max {
+					o = t.DeleteMaxN(n)
+				} else {
+					o = t.DeleteMinN(n)
+				}
+				c.Assert(len(o), check.Equals, n)
+				for i, e := range o {
+					want := compInt(i)
+					if max {
+						want = compInt(size - 1 - i)
+					}
+					c.Check(e, check.Equals, want)
+				}
+				c.Check(t.Len(), check.Equals, size-n)
+				c.Check(t.isBST(), check.Equals, true)
+				c.Check(t.is23_234(), check.Equals, true)
+				c.Check(t.isBalanced(), check.Equals, true)
+				for i := 0; i < size; i++ {
+					deleted := i < n
+					if max {
+						deleted = i >= size-n
+					}
+					c.Check(t.Get(compInt(i)) == nil, check.Equals, deleted)
+				}
+				t.Insert(compInt(size))
+				t.Delete(compInt(size))
+				c.Check(t.Len(), check.Equals, size-n)
+				c.Check(t.isBST(), check.Equals, true)
+				c.Check(t.isBalanced(), check.Equals, true)
+			}
+		}
+	}
+}
+
+func (s *S) TestRebalance(c *check.C) {
+	for n := 0; n <= 1000; n++ {
+		// Build a degenerate right-leaning chain.
+		t := &Tree{}
+		for i := n - 1; i >= 0; i-- {
+			t.Root = &Node{Elem: compInt(i), Right: t.Root, Color: Black}
+		}
+		t.Rebalance()
+		c.Check(t.Len(), check.Equals, n)
+		failed := false
+		failed = failed || !c.Check(t.isBST(), check.Equals, true)
+		failed = failed || !c.Check(t.is23_234(), check.Equals, true)
+		failed = failed || !c.Check(t.isBalanced(), check.Equals, true)
+		if failed {
+			if *printTree {
+				c.Logf("Failing tree: %s\n\n", describeTree(t.Root, false, true))
+			}
+			c.Fatalf("Cannot continue test: invariant contradiction for %d values", n)
+		}
+		var minHeight int
+		for m := n; m > 0; m >>= 1 {
+			minHeight++
+		}
+		c.Check(t.Root.height() <= minHeight+1, check.Equals, true, check.Commentf("n=%d height=%d", n, t.Root.height()))
+		var got []int
+		t.Do(func(e Comparable) (done bool) { got = append(got, int(e.(compInt))); return })
+		for i, v := range got {
+			if !c.Check(v, check.Equals, i) {
+				break
+			}
+		}
+
+		// Rebalanced trees remain valid LLRB trees under further operations.
+		t.Insert(compInt(n))
+		t.DeleteMin()
+		c.Check(t.Len(), check.Equals, n)
+		c.Check(t.isBST(), check.Equals, true)
+		c.Check(t.is23_234(), check.Equals, true)
+		c.Check(t.isBalanced(), check.Equals, true)
+	}
+}
+
 func (s *S) TestRandomInsertionDeletion(c *check.C) {
 	var (
 		count, max = 100000, 1000
@@ -882,6 +1246,31 @@ func (s *S) TestDoShortCircuit(c *check.C) {
 	c.Check(killed, check.Equals, true)
 }
 
+func (s *S) TestFold(c *check.C) {
+	t := &Tree{}
+	c.Check(t.Fold(0, func(acc interface{}, e Comparable) interface{} { return acc.(int) + 1 }), check.Equals, 0)
+	for i := 0; i < 1000; i++ {
+		t.Insert(compInt(rand.Intn(10000)))
+	}
+	var sum int
+	t.Do(func(e Comparable) (done bool) {
+		sum += int(e.(compInt))
+		return
+	})
+	c.Check(t.Fold(0, func(acc interface{}, e Comparable) interface{} {
+		return acc.(int) + int(e.(compInt))
+	}), check.Equals, sum)
+
+	var order compInts
+	t.Do(func(e Comparable) (done bool) {
+		order = append(order, e.(compInt))
+		return
+	})
+	c.Check(t.Fold(compInts(nil), func(acc interface{}, e Comparable) interface{} {
+		return append(acc.(compInts), e.(compInt))
+	}), check.DeepEquals, order)
+}
+
 func (s *S) TestDoReverse(c *check.C) {
 	values := append(compInts(nil), values...)
 	t := &Tree{}
@@ -921,6 +1310,27 @@ func (s *S) TestDoRange(c *check.C) {
 	c.Check(killed, check.Equals, false)
 }
 
+func (s *S) TestRangeFold(c *check.C) {
+	sum := func(acc interface{}, e Comparable) interface{} { return acc.(int) + int(e.(compInt)) }
+	c.Check((&Tree{}).RangeFold(compInt(0), compInt(10), 0, sum), check.Equals, 0)
+
+	t := &Tree{}
+	for i := 0; i < 1000; i++ {
+		t.Insert(compInt(rand.Intn(10000)))
+	}
+	for i := 0; i < 100; i++ {
+		from := compInt(rand.Intn(11000) - 500)
+		to := from + compInt(rand.Intn(5000))
+		var want int
+		t.DoRange(func(e Comparable) (done bool) {
+			want += int(e.(compInt))
+			return
+		}, from, to)
+		c.Check(t.RangeFold(from, to, 0, sum), check.Equals, want, check.Commentf("[%d,%d)", from, to))
+	}
+	c.Check(func() { t.RangeFold(compInt(10), compInt(0), 0, sum) }, check.PanicMatches, "llrb: inverted range")
+}
+
 func (s *S) TestDoRangeReverse(c *check.C) {
 	values := append(compInts(nil), values...)
 	lo, hi := compInt(0), compInt(100)
@@ -960,6 +1370,35 @@ func (s *S) TestDoMatch(c *check.C) {
 	c.Check(killed, check.Equals, false)
 }
 
+func (s *S) TestMergeTrees(c *check.C) {
+	var (
+		trees = []*Tree{{}, {}, {}, nil, {}}
+		all   compInts
+	)
+	for i := 0; i < 1000; i++ {
+		v := compInt(rand.Intn(10000))
+		trees[i%3].Insert(v)
+	}
+	for _, t := range trees {
+		if t != nil {
+			t.Do(func(e Comparable) (done bool) { all = append(all, e.(compInt)); return })
+		}
+	}
+	sort.Sort(all)
+
+	var got compInts
+	killed := MergeTrees(func(e Comparable) (done bool) { got = append(got, e.(compInt)); return }, trees...)
+	c.Check(killed, check.Equals, false)
+	c.Check(got, check.DeepEquals, all)
+
+	got = got[:0]
+	killed = MergeTrees(func(e Comparable) (done bool) { got = append(got, e.(compInt)); return len(got) == 10 }, trees...)
+	c.Check(killed, check.Equals, true)
+	c.Check(got, check.DeepEquals, all[:10])
+
+	c.Check(MergeTrees(func(Comparable) bool { panic("unexpected call") }), check.Equals, false)
+}
+
 // Benchmarks
 
 func BenchmarkInsert(b *testing.B) {
@@ -976,6 +1415,16 @@ func BenchmarkInsertNoRep(b *testing.B) {
 	}
 }
 
+func BenchmarkInsertRandom(b *testing.B) {
+	b.StopTimer()
+	keys := testutil.New(1).Ints(b.N)
+	t := &Tree{}
+	b.StartTimer()
+	for _, k := range keys {
+		t.Insert(compInt(k))
+	}
+}
+
 func BenchmarkGet(b *testing.B) {
 	b.StopTimer()
 	t := &Tree{}
@@ -1016,6 +1465,33 @@ func BenchmarkMax(b *testing.B) {
 	_ = m
 }
 
+func BenchmarkGetRandom(b *testing.B) {
+	b.StopTimer()
+	src := testutil.New(1)
+	t := &Tree{}
+	for _, k := range src.Intn(b.N, b.N) {
+		t.Insert(compInt(k))
+	}
+	keys := src.Intn(b.N, b.N)
+	b.StartTimer()
+	for _, k := range keys {
+		t.Get(compInt(k))
+	}
+}
+
+func BenchmarkDeleteRandom(b *testing.B) {
+	b.StopTimer()
+	keys := testutil.New(1).Ints(b.N)
+	t := &Tree{}
+	for _, k := range keys {
+		t.Insert(compInt(k))
+	}
+	b.StartTimer()
+	for _, k := range keys {
+		t.Delete(compInt(k))
+	}
+}
+
 func BenchmarkDelete(b *testing.B) {
 	b.StopTimer()
 	t := &Tree{}
@@ -1040,6 +1516,18 @@ func BenchmarkDeleteMin(b *testing.B) {
 	}
 }
 
+func BenchmarkDeleteMinN1(b *testing.B) {
+	b.StopTimer()
+	t := &Tree{}
+	for i := 0; i < b.N; i++ {
+		t.Insert(compInt(b.N - i))
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		t.DeleteMinN(1)
+	}
+}
+
 // Benchmarks for comparison to the built-in type.
 
 func BenchmarkInsertMap(b *testing.B) {
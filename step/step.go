@@ -9,9 +9,16 @@
 package step
 
 import (
+	"container/heap"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
 
+	"github.com/biogo/store/interval"
 	"github.com/biogo/store/llrb"
 )
 
@@ -19,8 +26,31 @@ var (
 	ErrOutOfRange    = errors.New("step: index out of range")
 	ErrInvertedRange = errors.New("step: inverted range")
 	ErrZeroLength    = errors.New("step: attempt to create zero length vector")
+	ErrTypeMismatch  = errors.New("step: value type mismatch")
+	ErrBinWidth      = errors.New("step: non-positive bin width")
+	ErrBadEncoding   = errors.New("step: invalid encoding")
 )
 
+// A RangeError records an attempt to access a position outside the extent of a Vector.
+// A RangeError wraps ErrOutOfRange, so errors.Is(err, ErrOutOfRange) reports true for
+// a RangeError.
+type RangeError struct {
+	Pos        int // Pos is the first requested position outside the Vector.
+	Start, End int // Start and End are the extent of the Vector.
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("step: index %d out of range [%d,%d)", e.Pos, e.Start, e.End)
+}
+
+// Unwrap returns ErrOutOfRange.
+func (e *RangeError) Unwrap() error { return ErrOutOfRange }
+
+// rangeError returns a RangeError for the position pos and the current extent of v.
+func (v *Vector) rangeError(pos int) error {
+	return &RangeError{Pos: pos, Start: v.Start(), End: v.End()}
+}
+
 type (
 	position struct {
 		pos int
@@ -118,6 +148,194 @@ func New(start, end int, zero Equaler) (*Vector, error) {
 	return v, nil
 }
 
+// NewCompact returns a new Vector with the extent defined by start and end and the ground
+// state defined by zero, holding the result of setting each of the ranges in edits in order.
+// Overlapping edits are resolved before the Vector is built, and the steps of the Vector are
+// allocated together, so constructing a Vector from many edits with NewCompact is cheaper than
+// calling SetRange for each edit. The returned Vector holds the minimal number of steps. If
+// a zero length vector is requested ErrZeroLength is returned, if any edit is inverted
+// ErrInvertedRange is returned, and if any edit is not within [start, end) a *RangeError
+// is returned.
+func NewCompact(start, end int, zero Equaler, edits []Step) (*Vector, error) {
+	if start >= end {
+		return nil, ErrZeroLength
+	}
+	v := &Vector{
+		Zero: zero,
+		min:  &position{pos: start, val: zero},
+		max:  &position{pos: end, val: nil},
+	}
+	for _, e := range edits {
+		if err := v.checkRange(e); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fill the gaps between edits with zero, merging
+	// neighbouring steps that hold equal values.
+	steps := make([]Step, 0, 2*len(edits)+1)
+	add := func(s Step) {
+		if n := len(steps); n != 0 && s.Value.Equal(steps[n-1].Value) {
+			steps[n-1].End = s.End
+			return
+		}
+		steps = append(steps, s)
+	}
+	last := start
+	for _, s := range resolveRanges(edits) {
+		if s.Start > last {
+			add(Step{Start: last, End: s.Start, Value: zero})
+		}
+		add(s)
+		last = s.End
+	}
+	if last < end {
+		add(Step{Start: last, End: end, Value: zero})
+	}
+
+	return fromSteps(zero, steps), nil
+}
+
+// fromSteps returns a new Vector with the ground state zero holding steps, which must
+// be contiguous, ascending and coalesced. The positions of the Vector are allocated
+// together.
+func fromSteps(zero Equaler, steps []Step) *Vector {
+	v := &Vector{Zero: zero}
+	arena := make([]position, len(steps)+1)
+	for i, s := range steps {
+		arena[i] = position{pos: s.Start, val: s.Value}
+		v.t.Insert(&arena[i])
+	}
+	arena[len(steps)] = position{pos: steps[len(steps)-1].End}
+	v.min, v.max = &arena[0], &arena[len(steps)]
+	v.t.Insert(v.max)
+	return v
+}
+
+// Encode calls emit with the start position and value of each step of the Vector in
+// ascending order, followed by the end of the Vector with a nil value. If emit returns
+// a non-nil error, Encode stops and returns the error.
+func (v *Vector) Encode(emit func(pos int, val Equaler) error) error {
+	var err error
+	v.t.Do(func(c llrb.Comparable) (done bool) {
+		p := c.(*position)
+		err = emit(p.pos, p.val)
+		return err != nil
+	})
+	return err
+}
+
+// Decode returns a new Vector with the extent defined by start and end and the ground
+// state defined by zero, holding the steps returned by successive calls to next, in the
+// form written by Encode. next returns ok false when no further steps are available. The
+// first step must start at start, steps must be in ascending order and the final step must
+// be followed by end with a nil value. Adjacent steps with equal values are merged. If a
+// zero length vector is requested ErrZeroLength is returned, if next returns a non-nil
+// error that error is returned, and if the steps are not valid ErrBadEncoding is returned.
+func Decode(start, end int, zero Equaler, next func() (pos int, val Equaler, ok bool, err error)) (*Vector, error) {
+	if start >= end {
+		return nil, ErrZeroLength
+	}
+	var (
+		steps []Step
+		last  int
+	)
+	for {
+		pos, val, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrBadEncoding
+		}
+		n := len(steps)
+		switch {
+		case n == 0 && pos != start:
+			return nil, ErrBadEncoding
+		case n != 0 && pos <= last:
+			return nil, ErrBadEncoding
+		case val == nil:
+			if n == 0 || pos != end {
+				return nil, ErrBadEncoding
+			}
+			steps[n-1].End = end
+			return fromSteps(zero, steps), nil
+		case pos >= end:
+			return nil, ErrBadEncoding
+		}
+		last = pos
+		if n != 0 {
+			if val.Equal(steps[n-1].Value) {
+				continue
+			}
+			steps[n-1].End = pos
+		}
+		steps = append(steps, Step{Start: pos, Value: val})
+	}
+}
+
+// Merge returns a new Vector with the ground state zero over the union of the extents of a
+// and b, holding at each position the result of f applied to the values of a and b at that
+// position. Positions outside the extent of a or b are taken to hold the Zero value of that
+// Vector. The step sequences of a and b are walked together, so f is called once for each
+// distinct pair of overlapping steps rather than for each position. If f returns nil,
+// ErrTypeMismatch is returned.
+func Merge(a, b *Vector, f func(x, y Equaler) Equaler, zero Equaler) (*Vector, error) {
+	start, end := a.Start(), a.End()
+	if b.Start() < start {
+		start = b.Start()
+	}
+	if b.End() > end {
+		end = b.End()
+	}
+
+	var as, bs []Step
+	bounds := []int{start, end, a.End(), b.End()}
+	a.Do(func(s, e int, ev Equaler) {
+		as = append(as, Step{Start: s, End: e, Value: ev})
+		bounds = append(bounds, s)
+	})
+	b.Do(func(s, e int, ev Equaler) {
+		bs = append(bs, Step{Start: s, End: e, Value: ev})
+		bounds = append(bounds, s)
+	})
+	sort.Ints(bounds)
+
+	var (
+		steps  []Step
+		ai, bi int
+	)
+	for k, lo := range bounds[:len(bounds)-1] {
+		hi := bounds[k+1]
+		if lo == hi {
+			continue
+		}
+		e := f(stepValue(as, &ai, lo, a.Zero), stepValue(bs, &bi, lo, b.Zero))
+		if e == nil {
+			return nil, ErrTypeMismatch
+		}
+		if n := len(steps); n != 0 && e.Equal(steps[n-1].Value) {
+			steps[n-1].End = hi
+			continue
+		}
+		steps = append(steps, Step{Start: lo, End: hi, Value: e})
+	}
+	return fromSteps(zero, steps), nil
+}
+
+// stepValue returns the value of the step in steps holding position p, or zero if no
+// step holds p. The index *i is advanced past steps ending at or before p, so successive
+// calls must be made with non-decreasing p.
+func stepValue(steps []Step, i *int, p int, zero Equaler) Equaler {
+	for *i < len(steps) && steps[*i].End <= p {
+		*i++
+	}
+	if *i < len(steps) && steps[*i].Start <= p {
+		return steps[*i].Value
+	}
+	return zero
+}
+
 // Start returns the index of minimum position of the Vector.
 func (v *Vector) Start() int { return v.min.pos }
 
@@ -131,32 +349,124 @@ func (v *Vector) Len() int { return v.End() - v.Start() }
 // Count returns the number of steps represented in the vector.
 func (v *Vector) Count() int { return v.t.Len() - 1 }
 
+// DistinctValues returns the number of distinct step values held by the Vector,
+// according to the Equal method of the stored values. DistinctValues performs a
+// pairwise comparison of step values, so its cost is O(n*k) for n steps and k distinct
+// values.
+func (v *Vector) DistinctValues() int {
+	var seen []Equaler
+	v.Do(func(_, _ int, e Equaler) {
+		for _, s := range seen {
+			if e.Equal(s) {
+				return
+			}
+		}
+		seen = append(seen, e)
+	})
+	return len(seen)
+}
+
+// LongestRun returns the extent and value of the longest step in the Vector. Since adjacent
+// steps with equal values are coalesced, this is the longest run of any single value. Ties
+// are resolved to the left-most step.
+func (v *Vector) LongestRun() (start, end int, val Equaler) {
+	v.Do(func(s, e int, ev Equaler) {
+		if val == nil || e-s > end-start {
+			start, end, val = s, e, ev
+		}
+	})
+	return start, end, val
+}
+
+// LongestRunOf returns the extent of the longest step in the Vector with a value equal to
+// target, and whether any step holds target. Ties are resolved to the left-most step.
+func (v *Vector) LongestRunOf(target Equaler) (start, end int, ok bool) {
+	v.Do(func(s, e int, ev Equaler) {
+		if ev.Equal(target) && (!ok || e-s > end-start) {
+			start, end, ok = s, e, true
+		}
+	})
+	return start, end, ok
+}
+
+// A Range is a half-open range of positions, [Start, End).
+type Range struct {
+	Start, End int
+}
+
+// RangesAtLeast returns the maximal ranges of the Vector over which step values are at least
+// threshold according to ge, which must return whether a is greater than or equal to b. Adjacent
+// qualifying steps are merged into a single range. The returned ranges are in ascending order.
+func (v *Vector) RangesAtLeast(threshold Equaler, ge func(a, b Equaler) bool) []Range {
+	var r []Range
+	v.Do(func(start, end int, e Equaler) {
+		if !ge(e, threshold) {
+			return
+		}
+		if len(r) != 0 && r[len(r)-1].End == start {
+			r[len(r)-1].End = end
+			return
+		}
+		r = append(r, Range{Start: start, End: end})
+	})
+	return r
+}
+
 // At returns the value of the vector at position i. If i is outside the extent
-// of the vector an error is returned.
+// of the vector a *RangeError is returned.
 func (v *Vector) At(i int) (Equaler, error) {
 	if i < v.Start() || i >= v.End() {
-		return nil, ErrOutOfRange
+		return nil, v.rangeError(i)
 	}
 	st := v.t.Floor(query(i)).(*position)
 	return st.val, nil
 }
 
 // StepAt returns the value and range of the step at i, where start <= i < end.
-// If i is outside the extent of the vector, an error is returned.
+// If i is outside the extent of the vector, a *RangeError is returned.
 func (v *Vector) StepAt(i int) (start, end int, e Equaler, err error) {
 	if i < v.Start() || i >= v.End() {
-		return 0, 0, nil, ErrOutOfRange
+		return 0, 0, nil, v.rangeError(i)
 	}
 	lo := v.t.Floor(query(i)).(*position)
 	hi := v.t.Ceil(upper(i)).(*position)
 	return lo.pos, hi.pos, lo.val, nil
 }
 
-// Set sets the value of position i to e.
+// A Step is a value held over the range [Start, End). Steps are used in two ways. A Step
+// returned by AtStep is a cached step of a Vector and is invalidated by any mutation of the
+// Vector it was obtained from. A Step passed to SetRangeFunc or NewCompact describes an
+// edit to be made; it does not refer to any Vector and is not invalidated by mutation.
+type Step struct {
+	Start, End int     // The range of the step, [Start, End).
+	Value      Equaler // The value of the step.
+}
+
+// Contains returns whether position i is within the step.
+func (s Step) Contains(i int) bool { return s.Start <= i && i < s.End }
+
+// AtStep returns the step of the vector holding position i. If last contains i, it is
+// returned without searching the vector, so passing the Step returned by the previous call
+// to AtStep allows nearby positions to be accessed cheaply. last must have been obtained
+// from v since its most recent mutation, or be the zero Step. If i is outside the extent
+// of the vector a *RangeError is returned.
+func (v *Vector) AtStep(i int, last Step) (Step, error) {
+	if last.Contains(i) {
+		return last, nil
+	}
+	start, end, e, err := v.StepAt(i)
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{Start: start, End: end, Value: e}, nil
+}
+
+// Set sets the value of position i to e. If i is outside the extent of the vector and
+// the vector is not Relaxed, Set panics with a *RangeError.
 func (v *Vector) Set(i int, e Equaler) {
 	if i < v.min.pos || v.max.pos <= i {
 		if !v.Relaxed {
-			panic(ErrOutOfRange)
+			panic(v.rangeError(i))
 		}
 
 		if i < v.min.pos {
@@ -250,12 +560,13 @@ func (v *Vector) Set(i int, e Equaler) {
 	}
 }
 
-// SetRange sets the value of positions [start, end) to e.
+// SetRange sets the value of positions [start, end) to e. If the range is not within the
+// extent of the vector and the vector is not Relaxed, SetRange panics with a *RangeError.
 func (v *Vector) SetRange(start, end int, e Equaler) {
 	switch l := end - start; {
 	case l == 0:
 		if !v.Relaxed && (start < v.min.pos || start >= v.max.pos) {
-			panic(ErrOutOfRange)
+			panic(v.rangeError(start))
 		}
 		return
 	case l == 1:
@@ -265,8 +576,13 @@ func (v *Vector) SetRange(start, end int, e Equaler) {
 		panic(ErrInvertedRange)
 	}
 
-	if !v.Relaxed && (start < v.min.pos || end > v.max.pos || start == v.max.pos) {
-		panic(ErrOutOfRange)
+	if !v.Relaxed {
+		switch {
+		case start < v.min.pos || start == v.max.pos:
+			panic(v.rangeError(start))
+		case end > v.max.pos:
+			panic(v.rangeError(v.max.pos))
+		}
 	}
 
 	// Do fast path complete vector replacement if possible.
@@ -313,6 +629,25 @@ func (v *Vector) SetRange(start, end int, e Equaler) {
 		return
 	}
 
+	// Trim the ends of a range within the vector that already hold e,
+	// returning early if the entire range already holds e.
+	if v.min.pos <= start && end <= v.max.pos {
+		if e.Equal(v.t.Floor(query(start)).(*position).val) {
+			hi := v.t.Ceil(upper(start)).(*position).pos
+			if end <= hi {
+				return
+			}
+			start = hi
+		}
+		if lo := v.t.Floor(query(end - 1)).(*position); e.Equal(lo.val) {
+			end = lo.pos
+		}
+		if end-start == 1 {
+			v.Set(start, e)
+			return
+		}
+	}
+
 	// Handle cases where the given range
 	last := v.t.Floor(query(end)).(*position)
 	deleteRangeInclusive(&v.t, start, end)
@@ -357,6 +692,128 @@ func (v *Vector) SetRange(start, end int, e Equaler) {
 	}
 }
 
+// SetRangeFunc sets the values of the ranges described by the Start, End and Value fields of
+// the elements of ranges, giving the same result as calling SetRange for each element in order,
+// so where ranges overlap the last range in ranges wins. Overlaps are resolved and adjacent
+// ranges with equal values are merged before the Vector is altered, so each position is set
+// at most once. If any range is inverted, ErrInvertedRange is returned, and if the Vector is
+// not Relaxed and any range is not within the extent of the Vector a *RangeError is returned.
+// The Vector is not altered if an error is returned.
+func (v *Vector) SetRangeFunc(ranges []Step) error {
+	for _, r := range ranges {
+		if err := v.checkRange(r); err != nil {
+			return err
+		}
+	}
+	for _, r := range resolveRanges(ranges) {
+		v.SetRange(r.Start, r.End, r.Value)
+	}
+	return nil
+}
+
+// Overlay sets the values of the Vector to the values of b over each step of b holding a
+// value not equal to b's Zero value, leaving the Vector's values unaltered elsewhere. If the
+// Vector is not Relaxed and any such step of b is not within the extent of the Vector, a
+// *RangeError is returned and the Vector is not altered. If the Vector is Relaxed, it is
+// extended to include the steps of b.
+func (v *Vector) Overlay(b *Vector) error {
+	var steps []Step
+	b.Do(func(start, end int, e Equaler) {
+		if !e.Equal(b.Zero) {
+			steps = append(steps, Step{Start: start, End: end, Value: e})
+		}
+	})
+	for _, r := range steps {
+		if err := v.checkRange(r); err != nil {
+			return err
+		}
+	}
+	for _, r := range steps {
+		v.SetRange(r.Start, r.End, r.Value)
+	}
+	return nil
+}
+
+// checkRange returns an error if r is inverted, or if v is not Relaxed and r
+// is not within the extent of v.
+func (v *Vector) checkRange(r Step) error {
+	if r.End < r.Start {
+		return ErrInvertedRange
+	}
+	if !v.Relaxed {
+		if r.Start < v.min.pos || r.Start >= v.max.pos {
+			return v.rangeError(r.Start)
+		}
+		if r.End > v.max.pos {
+			return v.rangeError(v.max.pos)
+		}
+	}
+	return nil
+}
+
+// resolveRanges returns the disjoint, ascending ranges resulting from setting each
+// element of ranges in order, with adjacent ranges holding equal values merged.
+// Positions not covered by any element of ranges are not included.
+func resolveRanges(ranges []Step) []Step {
+	var bounds []int
+	for _, r := range ranges {
+		if r.Start != r.End {
+			bounds = append(bounds, r.Start, r.End)
+		}
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	sort.Ints(bounds)
+
+	// Sweep across the elementary segments between range bounds,
+	// keeping the ranges covering each segment in a heap ordered
+	// by input position so that the last writer is at the top.
+	order := make([]int, len(ranges))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return ranges[order[i]].Start < ranges[order[j]].Start })
+	var (
+		active lastWriter
+		merged []Step
+		next   int
+	)
+	for k, lo := range bounds[:len(bounds)-1] {
+		hi := bounds[k+1]
+		if lo == hi {
+			continue
+		}
+		for ; next < len(order) && ranges[order[next]].Start <= lo; next++ {
+			if r := ranges[order[next]]; r.Start != r.End {
+				heap.Push(&active, order[next])
+			}
+		}
+		for active.Len() != 0 && ranges[active[0]].End <= lo {
+			heap.Pop(&active)
+		}
+		if active.Len() == 0 {
+			continue
+		}
+		e := ranges[active[0]].Value
+		if last := len(merged) - 1; last >= 0 && merged[last].End == lo && e.Equal(merged[last].Value) {
+			merged[last].End = hi
+			continue
+		}
+		merged = append(merged, Step{Start: lo, End: hi, Value: e})
+	}
+	return merged
+}
+
+// lastWriter is a max heap of indices into the ranges passed to SetRangeFunc.
+type lastWriter []int
+
+func (h lastWriter) Len() int              { return len(h) }
+func (h lastWriter) Less(i, j int) bool    { return h[i] > h[j] }
+func (h lastWriter) Swap(i, j int)         { h[i], h[j] = h[j], h[i] }
+func (h *lastWriter) Push(x interface{})   { *h = append(*h, x.(int)) }
+func (h *lastWriter) Pop() (i interface{}) { i, *h = (*h)[len(*h)-1], (*h)[:len(*h)-1]; return i }
+
 // deleteRangeInclusive deletes all steps within the given range.
 // Note that llrb.(*Tree).DoRange does not operate on the node matching the end of a range.
 func deleteRangeInclusive(t *llrb.Tree, start, end int) {
@@ -405,7 +862,7 @@ func (v *Vector) DoRange(from, to int, fn Operation) error {
 		max = v.max.pos
 	)
 	if to <= min || from >= max {
-		return ErrOutOfRange
+		return v.rangeError(from)
 	}
 
 	_, end, e, _ := v.StepAt(from)
@@ -431,6 +888,203 @@ func (v *Vector) DoRange(from, to int, fn Operation) error {
 	return nil
 }
 
+// CountRange returns the number of steps of the Vector that intersect the range [from, to).
+// The range is clipped to the extent of the Vector. If the range does not overlap the Vector a
+// *RangeError is returned, and if to is less than from ErrInvertedRange is returned.
+func (v *Vector) CountRange(from, to int) (int, error) {
+	if to < from {
+		return 0, ErrInvertedRange
+	}
+	if to <= v.min.pos || from >= v.max.pos {
+		return 0, v.rangeError(from)
+	}
+	if from < v.min.pos {
+		from = v.min.pos
+	}
+	if to > v.max.pos {
+		to = v.max.pos
+	}
+	if from == to {
+		return 0, nil
+	}
+
+	// Count the step holding from and each step starting within (from, to).
+	n := 1
+	v.t.DoRange(func(_ llrb.Comparable) (done bool) {
+		n++
+		return
+	}, query(from+1), query(to))
+	return n, nil
+}
+
+// AnyNonZero returns whether any position in the range [from, to) holds a value that is not
+// equal to the Vector's Zero value. The search stops at the first such step. The range is
+// clipped to the extent of the Vector. If the range does not overlap the Vector a *RangeError
+// is returned, and if to is less than from ErrInvertedRange is returned.
+func (v *Vector) AnyNonZero(from, to int) (bool, error) {
+	if to < from {
+		return false, ErrInvertedRange
+	}
+	if to <= v.min.pos || from >= v.max.pos {
+		return false, v.rangeError(from)
+	}
+	if from < v.min.pos {
+		from = v.min.pos
+	}
+	if to > v.max.pos {
+		to = v.max.pos
+	}
+	if from == to {
+		return false, nil
+	}
+
+	if !v.t.Floor(query(from)).(*position).val.Equal(v.Zero) {
+		return true, nil
+	}
+	var found bool
+	v.t.DoRange(func(c llrb.Comparable) (done bool) {
+		found = !c.(*position).val.Equal(v.Zero)
+		return found
+	}, query(from+1), query(to))
+	return found, nil
+}
+
+// Stats returns the mean, population variance, minimum and maximum of the values held by
+// the Vector over the range [from, to), with each step weighted by the number of positions
+// it covers in the range. The values must all be Int or all be Float; otherwise
+// ErrTypeMismatch is returned. If any Float value in the range is NaN, all the returned
+// statistics are NaN. The range is clipped to the extent of the Vector, and if the clipped
+// range is empty all the returned statistics are NaN. If the range does not overlap the
+// Vector a *RangeError is returned, and if to is less than from ErrInvertedRange is returned.
+func (v *Vector) Stats(from, to int) (mean, variance, min, max float64, err error) {
+	if to < from {
+		return 0, 0, 0, 0, ErrInvertedRange
+	}
+	if to <= v.min.pos || from >= v.max.pos {
+		return 0, 0, 0, 0, v.rangeError(from)
+	}
+	if from < v.min.pos {
+		from = v.min.pos
+	}
+	if to > v.max.pos {
+		to = v.max.pos
+	}
+	nan := math.NaN()
+	if from == to {
+		return nan, nan, nan, nan, nil
+	}
+
+	var (
+		weight, m2 float64
+		isInt      bool
+	)
+	min, max = math.Inf(1), math.Inf(-1)
+	switch v.t.Floor(query(from)).(*position).val.(type) {
+	case Int:
+		isInt = true
+	case Float:
+	default:
+		return 0, 0, 0, 0, ErrTypeMismatch
+	}
+	v.DoRange(from, to, func(start, end int, e Equaler) {
+		if err != nil {
+			return
+		}
+		var x float64
+		switch e := e.(type) {
+		case Int:
+			x = float64(e)
+			if !isInt {
+				err = ErrTypeMismatch
+			}
+		case Float:
+			x = float64(e)
+			if isInt {
+				err = ErrTypeMismatch
+			}
+		default:
+			err = ErrTypeMismatch
+		}
+		if err != nil {
+			return
+		}
+
+		// Weighted incremental update of the mean and sum of squared deviations.
+		w := float64(end - start)
+		weight += w
+		d := x - mean
+		mean += d * w / weight
+		m2 += w * d * (x - mean)
+		min = math.Min(min, x)
+		max = math.Max(max, x)
+	})
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return mean, m2 / weight, min, max, nil
+}
+
+// FindFirst returns the first position of the Vector holding a value for which pred returns
+// true. The steps of the Vector are walked in ascending order and pred is called once for
+// each step until it returns true. If no step satisfies pred, ok is false.
+func (v *Vector) FindFirst(pred func(Equaler) bool) (pos int, ok bool) {
+	max := v.max.pos
+	v.t.Do(func(c llrb.Comparable) (done bool) {
+		p := c.(*position)
+		if p.pos == max {
+			return true
+		}
+		if pred(p.val) {
+			pos, ok = p.pos, true
+		}
+		return ok
+	})
+	return pos, ok
+}
+
+// FindLast returns the last position of the Vector holding a value for which pred returns
+// true. The steps of the Vector are walked in descending order and pred is called once for
+// each step until it returns true. If no step satisfies pred, ok is false.
+func (v *Vector) FindLast(pred func(Equaler) bool) (pos int, ok bool) {
+	max := v.max.pos
+	end := max
+	v.t.DoReverse(func(c llrb.Comparable) (done bool) {
+		p := c.(*position)
+		if p.pos == max {
+			return
+		}
+		if pred(p.val) {
+			pos, ok = end-1, true
+		}
+		end = p.pos
+		return ok
+	})
+	return pos, ok
+}
+
+// ToIntTree returns an interval.IntTree holding an interval for each step of the Vector
+// with a value not equal to the Vector's Zero value. The intervals are constructed by
+// calling factory with the start, end and value of each step, and factory is responsible
+// for giving each interval a unique ID. If the tree rejects an interval returned by
+// factory, ToIntTree returns a nil tree and the error returned by Insert.
+func (v *Vector) ToIntTree(factory func(start, end int, val Equaler) interval.IntInterface) (*interval.IntTree, error) {
+	var (
+		t   = &interval.IntTree{}
+		err error
+	)
+	v.Do(func(start, end int, e Equaler) {
+		if err != nil || e.Equal(v.Zero) {
+			return
+		}
+		err = t.Insert(factory(start, end, e), true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.AdjustRanges()
+	return t, nil
+}
+
 // A Mutator is a function that is used by Apply and ApplyRange to alter values within
 // a Vector.
 type Mutator func(Equaler) Equaler
@@ -478,9 +1132,45 @@ func (v *Vector) Apply(m Mutator) {
 	}
 }
 
+// ApplyCounting applies the mutator function m to steps stored in the Vector in the same way
+// as Apply, returning the number of steps present before the call whose values were changed
+// by m according to Equal. A return value of zero indicates that the Vector was not altered.
+func (v *Vector) ApplyCounting(m Mutator) (changed int) {
+	var (
+		la   Equaler
+		min  = v.min.pos
+		max  = v.max.pos
+		delQ []query
+	)
+
+	v.t.Do(func(c llrb.Comparable) (done bool) {
+		p := c.(*position)
+		if p.pos == max {
+			return true
+		}
+		old := p.val
+		p.val = m(p.val)
+		if !p.val.Equal(old) {
+			changed++
+		}
+		if p.pos != min && p.pos != max && p.val.Equal(la) {
+			delQ = append(delQ, query(p.pos))
+		}
+		la = p.val
+		return
+	})
+
+	for _, d := range delQ {
+		v.t.Delete(d)
+	}
+
+	return changed
+}
+
 // Apply applies the mutator function m to steps stored in the Vector in over the range
 // [from, to) in ascending sort order of start position. Redundant steps resulting from
-// changes in step values are erased.
+// changes in step values are erased. If the Vector is not Relaxed, the range is clipped
+// to the extent of the Vector.
 func (v *Vector) ApplyRange(from, to int, m Mutator) error {
 	if to < from {
 		return ErrInvertedRange
@@ -496,15 +1186,26 @@ func (v *Vector) ApplyRange(from, to int, m Mutator) error {
 		delQ []query
 	)
 	if !v.Relaxed && (to <= min || from >= max) {
-		return ErrOutOfRange
+		return v.rangeError(from)
 	}
 	if v.Relaxed {
 		if from < min {
+			// The Zero valued extension is mutated below as
+			// the first step of the range, so from is now min.
 			v.SetRange(from, min, v.Zero)
+			min = v.min.pos
 		}
 		if max < to {
 			v.SetRange(max, to, v.Zero)
 		}
+	} else if from < min {
+		from = min
+	}
+
+	// Do fast path complete vector application if possible.
+	if from <= v.min.pos && v.max.pos <= to {
+		v.Apply(m)
+		return nil
 	}
 
 	var end int
@@ -523,8 +1224,6 @@ func (v *Vector) ApplyRange(from, to int, m Mutator) error {
 			} else {
 				v.t.Delete(query(from))
 			}
-		case from < min:
-			v.SetRange(from, min, la)
 		default:
 			*v.min = position{from, la}
 		}
@@ -533,10 +1232,12 @@ func (v *Vector) ApplyRange(from, to int, m Mutator) error {
 	var tail *position
 	v.t.DoRange(func(c llrb.Comparable) (done bool) {
 		p := c.(*position)
-		if p.pos == max {
+		if p == v.max {
 			// We should be at v.t.Max(), but don't stop
 			// just in case there is more. We want to fail
-			// noisily if max < v.t.Max().
+			// noisily if max < v.t.Max(). A Relaxed vector
+			// extended to the right holds a Zero step at the
+			// previous max, which is mutated with the others.
 			return
 		}
 		if p.pos == to {
@@ -566,14 +1267,381 @@ func (v *Vector) ApplyRange(from, to int, m Mutator) error {
 				v.t.Delete(query(tail.pos))
 			}
 		}
+	}
+
+	return nil
+}
+
+// Recode returns a new Vector with the extent of v where each step value, and the Zero value,
+// is replaced by its mapping in m, or by missing if the value is not a key of m. Adjacent steps
+// with equal recoded values are coalesced. Values stored in v must be hashable; RecodeFunc
+// should be used for vectors holding values that are not.
+func (v *Vector) Recode(m map[Equaler]Equaler, missing Equaler) *Vector {
+	return v.RecodeFunc(func(e Equaler) Equaler {
+		if r, ok := m[e]; ok {
+			return r
+		}
+		return missing
+	})
+}
+
+// RecodeFunc returns a new Vector with the extent of v where each step value, and the Zero
+// value, is replaced by the result of calling fn on it. Adjacent steps with equal recoded
+// values are coalesced. fn is not permitted to alter the values it is passed.
+func (v *Vector) RecodeFunc(fn Mutator) *Vector {
+	r := &Vector{Zero: fn(v.Zero), Relaxed: v.Relaxed}
+	var last *position
+	v.Do(func(start, _ int, e Equaler) {
+		e = fn(e)
+		if last != nil && e.Equal(last.val) {
+			return
+		}
+		last = &position{pos: start, val: e}
+		if r.min == nil {
+			r.min = last
+		}
+		r.t.Insert(last)
+	})
+	r.max = &position{pos: v.End()}
+	r.t.Insert(r.max)
+	return r
+}
+
+// Split returns two new Vectors, left and right, holding the steps of v over [v.Start(), p)
+// and [p, v.End()) respectively. A step spanning p is clipped at p in both halves. The returned
+// Vectors share the Zero and Relaxed settings of v but are otherwise independent of it. If p
+// is outside the extent of v, a *RangeError is returned, and if p is at the start or end of v,
+// resulting in an empty half, ErrZeroLength is returned.
+func (v *Vector) Split(p int) (left, right *Vector, err error) {
+	switch {
+	case p < v.Start() || p > v.End():
+		return nil, nil, v.rangeError(p)
+	case p == v.Start() || p == v.End():
+		return nil, nil, ErrZeroLength
+	}
+	left = &Vector{Zero: v.Zero, Relaxed: v.Relaxed}
+	right = &Vector{Zero: v.Zero, Relaxed: v.Relaxed}
+	v.Do(func(start, end int, e Equaler) {
+		if start < p {
+			s := &position{pos: start, val: e}
+			if left.min == nil {
+				left.min = s
+			}
+			left.t.Insert(s)
+		}
+		if end > p {
+			if start < p {
+				start = p
+			}
+			s := &position{pos: start, val: e}
+			if right.min == nil {
+				right.min = s
+			}
+			right.t.Insert(s)
+		}
+	})
+	left.max = &position{pos: p}
+	left.t.Insert(left.max)
+	right.max = &position{pos: v.End()}
+	right.t.Insert(right.max)
+	return left, right, nil
+}
+
+// A WeightedValue is a step value paired with the number of positions it covers.
+type WeightedValue struct {
+	Width int
+	Val   Equaler
+}
+
+// Downsample returns a new Vector with the extent of v holding one step per bin of width
+// binWidth, starting from the start of v. The final bin is truncated at the end of v if the
+// length of v is not a multiple of binWidth. The value of each bin is the result of calling
+// agg on the values of the steps of v within the bin, in ascending order and weighted by
+// the number of positions they cover in the bin. The slice passed to agg is reused between
+// calls, so agg must not retain it. Adjacent bins with equal values are coalesced.
+// If binWidth is not positive, ErrBinWidth is returned.
+func (v *Vector) Downsample(binWidth int, agg func(vals []WeightedValue) Equaler) (*Vector, error) {
+	return v.Resample(v.Start(), v.End(), binWidth, agg)
+}
+
+// Resample returns a new Vector over [newStart, newEnd) holding one step per bin of width
+// stride, starting from newStart. The final bin is truncated at newEnd if the length of the
+// new extent is not a multiple of stride. The value of each bin is the result of calling
+// pick on the values of the steps of v within the bin, in ascending order and weighted by
+// the number of positions they cover in the bin. Positions of a bin outside the extent of v
+// are passed to pick as v.Zero. A stride smaller than the steps of v upsamples, with each
+// bin receiving a single value. The slice passed to pick is reused between calls, so pick
+// must not retain it. Adjacent bins with equal values are coalesced. If stride is not
+// positive, ErrBinWidth is returned.
+func (v *Vector) Resample(newStart, newEnd, stride int, pick func(vals []WeightedValue) Equaler) (*Vector, error) {
+	if stride <= 0 {
+		return nil, ErrBinWidth
+	}
+	d, err := New(newStart, newEnd, v.Zero)
+	if err != nil {
+		return nil, err
+	}
+	d.Relaxed = v.Relaxed
+	var (
+		vals []WeightedValue
+		bin  = newStart
+		last = newStart
+	)
+	flush := func(end int) {
+		d.SetRange(bin, end, pick(vals))
+		vals = vals[:0]
+		bin = end
+	}
+	add := func(start, end int, e Equaler) {
+		if start < newStart {
+			start = newStart
+		}
+		if end > newEnd {
+			end = newEnd
+		}
+		for start < end {
+			binEnd := bin + stride
+			if binEnd > newEnd {
+				binEnd = newEnd
+			}
+			if end < binEnd {
+				vals = append(vals, WeightedValue{Width: end - start, Val: e})
+				return
+			}
+			vals = append(vals, WeightedValue{Width: binEnd - start, Val: e})
+			start = binEnd
+			flush(binEnd)
+		}
+	}
+	v.Do(func(start, end int, e Equaler) {
+		if start > last {
+			add(last, start, v.Zero)
+		}
+		add(start, end, e)
+		last = end
+	})
+	if last < newEnd {
+		add(last, newEnd, v.Zero)
+	}
+	if len(vals) != 0 {
+		flush(newEnd)
+	}
+	return d, nil
+}
+
+// AddRange adds delta to the values of steps stored in the Vector over the range [from, to).
+// The underlying type of delta must be Int or Float and must match the type of every value
+// stored over the range, and of Zero if the Vector is Relaxed and the range extends beyond
+// the Vector; otherwise ErrTypeMismatch is returned and the Vector is not altered. Steps
+// spanning the ends of the range are split and redundant steps resulting from the addition
+// are erased. AddRange is a convenience wrapper around ApplyRange with an adding Mutator
+// and is no more efficient than ApplyRange; the range is visited once to check the value
+// types and again to apply the addition.
+func (v *Vector) AddRange(from, to int, delta Equaler) error {
+	if to < from {
+		return ErrInvertedRange
+	}
+	var (
+		m    Mutator
+		isOf func(Equaler) bool
+	)
+	switch d := delta.(type) {
+	case Int:
+		isOf = func(e Equaler) bool { _, ok := e.(Int); return ok }
+		m = func(e Equaler) Equaler { return e.(Int) + d }
+	case Float:
+		isOf = func(e Equaler) bool { _, ok := e.(Float); return ok }
+		m = func(e Equaler) Equaler { return e.(Float) + d }
+	default:
+		return ErrTypeMismatch
+	}
+	if from == to {
 		return nil
 	}
+	if v.Relaxed && (from < v.min.pos || v.max.pos < to) && !isOf(v.Zero) {
+		return ErrTypeMismatch
+	}
+	lo, hi := from, to
+	if lo < v.min.pos {
+		lo = v.min.pos
+	}
+	if hi > v.max.pos {
+		hi = v.max.pos
+	}
+	if lo < hi {
+		ok := true
+		v.DoRange(lo, hi, func(_, _ int, e Equaler) {
+			ok = ok && isOf(e)
+		})
+		if !ok {
+			return ErrTypeMismatch
+		}
+	}
+	return v.ApplyRange(from, to, m)
+}
+
+// Integrate returns a new Vector with the extent of v where the value at each position i is
+// the sum of the values of v over [v.Start(), i]. The values stored in v must all be Int or
+// all be Float; otherwise ErrTypeMismatch is returned. The returned Vector's Zero is the zero
+// value of the stored type. Since the cumulative sum changes at every position covered by a
+// non-zero step, the returned Vector may hold O(v.Len()) steps; callers needing prefix sums
+// over long vectors with few zero-valued steps may prefer to calculate them into a slice.
+func (v *Vector) Integrate() (*Vector, error) {
+	var (
+		zero Equaler
+		add  func(a, b Equaler) (Equaler, bool)
+	)
+	switch v.min.val.(type) {
+	case Int:
+		zero = Int(0)
+		add = func(a, b Equaler) (Equaler, bool) {
+			d, ok := b.(Int)
+			return a.(Int) + d, ok
+		}
+	case Float:
+		zero = Float(0)
+		add = func(a, b Equaler) (Equaler, bool) {
+			d, ok := b.(Float)
+			return a.(Float) + d, ok
+		}
+	default:
+		return nil, ErrTypeMismatch
+	}
 
-	if v.Relaxed && to > max {
-		v.SetRange(max, to, m(v.Zero))
+	var (
+		r    = &Vector{Zero: zero}
+		sum  = zero
+		last *position
+		ok   = true
+	)
+	v.Do(func(start, end int, e Equaler) {
+		if !ok {
+			return
+		}
+		for i := start; i < end; i++ {
+			sum, ok = add(sum, e)
+			if !ok {
+				return
+			}
+			if last != nil && sum.Equal(last.val) {
+				if e.Equal(zero) {
+					// The sum is constant over the remainder of the step.
+					break
+				}
+				continue
+			}
+			last = &position{pos: i, val: sum}
+			if r.min == nil {
+				r.min = last
+			}
+			r.t.Insert(last)
+		}
+	})
+	if !ok {
+		return nil, ErrTypeMismatch
 	}
+	r.max = &position{pos: v.End()}
+	r.t.Insert(r.max)
+	return r, nil
+}
 
-	return nil
+// EqualApprox returns whether v and o have the same extent and hold approximately equal
+// values at every position. Float values are considered equal if they differ by no more
+// than eps or are both NaN, and other values are compared using their Equal method. The
+// step boundaries of v and o need not coincide.
+func (v *Vector) EqualApprox(o *Vector, eps float64) bool {
+	if v.Start() != o.Start() || v.End() != o.End() {
+		return false
+	}
+	a, b := v.steps(), o.steps()
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if !equalApprox(a[i].val, b[j].val, eps) {
+			return false
+		}
+		switch {
+		case a[i].pos < b[j].pos:
+			i++
+		case a[i].pos > b[j].pos:
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return true
+}
+
+// A Hasher is an Equaler that can provide a hash of its value. Values that are Equal
+// must return the same hash.
+type Hasher interface {
+	Equaler
+	Hash() uint64
+}
+
+// Hash returns a content hash of the vector computed over its extent, its Zero value
+// and its ordered steps. Vectors that are Equal hash identically. Int and Float step
+// values are supported directly, with all NaN values and both signed zeros of a Float
+// hashing identically as they compare Equal; other value types must implement Hasher.
+// Hash panics if a value is of an unsupported type.
+func (v *Vector) Hash() uint64 {
+	h := fnv.New64a()
+	writeUint64(h, uint64(v.Start()))
+	writeUint64(h, uint64(v.End()))
+	writeUint64(h, hashValue(v.Zero))
+	v.Do(func(_, end int, e Equaler) {
+		writeUint64(h, uint64(end))
+		writeUint64(h, hashValue(e))
+	})
+	return h.Sum64()
+}
+
+func writeUint64(h hash.Hash64, u uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], u)
+	h.Write(b[:])
+}
+
+// hashValue returns a hash of e such that Equal values hash identically.
+func hashValue(e Equaler) uint64 {
+	switch e := e.(type) {
+	case Int:
+		return uint64(e)
+	case Float:
+		switch {
+		case e != e:
+			return math.Float64bits(math.NaN())
+		case e == 0:
+			return 0
+		}
+		return math.Float64bits(float64(e))
+	case Hasher:
+		return e.Hash()
+	case nil:
+		return 0
+	}
+	panic(fmt.Sprintf("step: cannot hash value of type %T", e))
+}
+
+// steps returns the steps of the Vector in ascending order of position. The pos field
+// of each returned position holds the end of the step.
+func (v *Vector) steps() []position {
+	s := make([]position, 0, v.Count())
+	v.Do(func(_, end int, e Equaler) {
+		s = append(s, position{pos: end, val: e})
+	})
+	return s
+}
+
+func equalApprox(a, b Equaler, eps float64) bool {
+	af, aok := a.(Float)
+	bf, bok := b.(Float)
+	if !aok || !bok {
+		return a.Equal(b)
+	}
+	if af == bf || (af != af && bf != bf) {
+		return true
+	}
+	return math.Abs(float64(af-bf)) <= eps
 }
 
 // String returns a string representation a Vector, displaying step start
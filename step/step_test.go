@@ -6,6 +6,7 @@ package step
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -13,6 +14,10 @@ import (
 	"testing"
 
 	"gopkg.in/check.v1"
+
+	"github.com/biogo/store/internal/testutil"
+	"github.com/biogo/store/interval"
+	"github.com/biogo/store/llrb"
 )
 
 // Tests
@@ -57,9 +62,145 @@ func (s *S) TestCreate(c *check.C) {
 			c.Check(err, check.Equals, nil)
 		}
 		_, err = sv.At(vec.start - 1)
-		c.Check(err, check.ErrorMatches, ErrOutOfRange.Error())
+		c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
 		_, err = sv.At(vec.start - 1)
-		c.Check(err, check.ErrorMatches, ErrOutOfRange.Error())
+		c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
+	}
+}
+
+func (s *S) TestRangeError(c *check.C) {
+	sv, err := New(1, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+
+	_, err = sv.At(10)
+	c.Check(err, check.DeepEquals, &RangeError{Pos: 10, Start: 1, End: 10})
+	c.Check(err, check.ErrorMatches, `step: index 10 out of range \[1,10\)`)
+	c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
+	c.Check(errors.Is(err, ErrInvertedRange), check.Equals, false)
+	var re *RangeError
+	c.Check(errors.As(err, &re), check.Equals, true)
+	c.Check(re.Pos, check.Equals, 10)
+
+	_, _, _, err = sv.StepAt(0)
+	c.Check(err, check.DeepEquals, &RangeError{Pos: 0, Start: 1, End: 10})
+	c.Check(sv.DoRange(12, 15, func(_, _ int, _ Equaler) {}), check.DeepEquals, &RangeError{Pos: 12, Start: 1, End: 10})
+	c.Check(sv.ApplyRange(-5, 0, IncInt), check.DeepEquals, &RangeError{Pos: -5, Start: 1, End: 10})
+	c.Check(func() { sv.SetRange(5, 12, Int(1)) }, check.Panics, &RangeError{Pos: 10, Start: 1, End: 10})
+	c.Check(func() { sv.SetRange(0, 0, Int(1)) }, check.Panics, &RangeError{Pos: 0, Start: 1, End: 10})
+	c.Check(sv.DoRange(5, 2, func(_, _ int, _ Equaler) {}), check.Equals, ErrInvertedRange)
+}
+
+func (s *S) TestDistinctValues(c *check.C) {
+	type posRange struct {
+		start, end int
+		val        Equaler
+	}
+	for i, t := range []struct {
+		zero   Equaler
+		sets   []posRange
+		expect int
+	}{
+		{Int(0), nil, 1},
+		{Int(0), []posRange{{1, 10, Int(3)}}, 2},
+		{Int(0), []posRange{{0, 10, Int(3)}}, 1},
+		{Int(0), []posRange{{2, 4, Int(1)}, {6, 8, Int(1)}}, 2},
+		{Int(0), []posRange{{1, 2, Int(1)}, {3, 4, Int(2)}, {5, 6, Int(3)}, {7, 8, Int(1)}}, 4},
+		{Float(0), []posRange{{1, 3, Float(math.NaN())}, {5, 7, Float(math.NaN())}}, 2},
+	} {
+		sv, err := New(0, 10, t.zero)
+		c.Assert(err, check.Equals, nil)
+		for _, v := range t.sets {
+			sv.SetRange(v.start, v.end, v.val)
+		}
+		c.Check(sv.DistinctValues(), check.Equals, t.expect, check.Commentf("subtest %d", i))
+	}
+}
+
+func (s *S) TestLongestRun(c *check.C) {
+	sv, err := New(0, 50, Int(0))
+	c.Assert(err, check.Equals, nil)
+	start, end, val := sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{0, 50})
+	c.Check(val, check.Equals, Int(0))
+
+	sv.SetRange(0, 3, Int(1))
+	sv.SetRange(5, 12, Int(2))
+	sv.SetRange(12, 19, Int(1))
+	sv.SetRange(25, 28, Int(1))
+	sv.SetRange(32, 50, Int(3))
+	c.Assert(sv.String(), check.Equals, "[0:1 3:0 5:2 12:1 19:0 25:1 28:0 32:3 50:<nil>]")
+
+	start, end, val = sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{32, 50})
+	c.Check(val, check.Equals, Int(3))
+	sv.SetRange(32, 50, Int(0))
+	start, end, val = sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{28, 50})
+	c.Check(val, check.Equals, Int(0))
+	sv.SetRange(29, 50, Int(4))
+	start, end, val = sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{29, 50})
+	c.Check(val, check.Equals, Int(4))
+	sv.SetRange(26, 50, Int(5))
+	start, end, val = sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{26, 50})
+	c.Check(val, check.Equals, Int(5))
+
+	for _, test := range []struct {
+		target     Equaler
+		start, end int
+		ok         bool
+	}{
+		{Int(1), 12, 19, true},
+		{Int(2), 5, 12, true},
+		{Int(0), 19, 25, true},
+		{Int(5), 26, 50, true},
+		{Int(9), 0, 0, false},
+	} {
+		start, end, ok := sv.LongestRunOf(test.target)
+		c.Check(ok, check.Equals, test.ok, check.Commentf("target %v", test.target))
+		if ok {
+			c.Check([]int{start, end}, check.DeepEquals, []int{test.start, test.end}, check.Commentf("target %v", test.target))
+		}
+	}
+
+	// Ties resolve to the left-most run.
+	sv, err = New(0, 12, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(0, 4, Int(1))
+	sv.SetRange(8, 12, Int(1))
+	start, end, val = sv.LongestRun()
+	c.Check([]int{start, end}, check.DeepEquals, []int{0, 4})
+	c.Check(val, check.Equals, Int(1))
+	start, end, _ = sv.LongestRunOf(Int(1))
+	c.Check([]int{start, end}, check.DeepEquals, []int{0, 4})
+}
+
+func (s *S) TestRangesAtLeast(c *check.C) {
+	ge := func(a, b Equaler) bool { return a.(Int) >= b.(Int) }
+	sv, err := New(0, 50, Int(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(sv.RangesAtLeast(Int(1), ge), check.IsNil)
+	c.Check(sv.RangesAtLeast(Int(0), ge), check.DeepEquals, []Range{{0, 50}})
+
+	sv.SetRange(0, 3, Int(1))
+	sv.SetRange(5, 12, Int(2))
+	sv.SetRange(12, 19, Int(1))
+	sv.SetRange(25, 28, Int(1))
+	sv.SetRange(32, 50, Int(3))
+	c.Assert(sv.String(), check.Equals, "[0:1 3:0 5:2 12:1 19:0 25:1 28:0 32:3 50:<nil>]")
+
+	for _, test := range []struct {
+		threshold Int
+		want      []Range
+	}{
+		{0, []Range{{0, 50}}},
+		{1, []Range{{0, 3}, {5, 19}, {25, 28}, {32, 50}}},
+		{2, []Range{{5, 12}, {32, 50}}},
+		{3, []Range{{32, 50}}},
+		{4, nil},
+	} {
+		c.Check(sv.RangesAtLeast(test.threshold, ge), check.DeepEquals, test.want, check.Commentf("threshold %d", test.threshold))
 	}
 }
 
@@ -126,8 +267,8 @@ func (s *S) TestSet_1(c *check.C) {
 	} {
 		sv, err := New(t.start, t.end, t.zero)
 		c.Assert(err, check.Equals, nil)
-		c.Check(func() { sv.Set(t.start-1, nil) }, check.Panics, ErrOutOfRange)
-		c.Check(func() { sv.Set(t.end, nil) }, check.Panics, ErrOutOfRange)
+		c.Check(func() { sv.Set(t.start-1, nil) }, check.Panics, &RangeError{Pos: t.start - 1, Start: t.start, End: t.end})
+		c.Check(func() { sv.Set(t.end, nil) }, check.Panics, &RangeError{Pos: t.end, Start: t.start, End: t.end})
 		for _, v := range t.sets {
 			sv.Set(v.pos, v.val)
 			c.Check(sv.min.pos, check.Equals, t.start)
@@ -439,8 +580,8 @@ func (s *S) TestSetRange_1(c *check.C) {
 	} {
 		sv, err := New(t.start, t.end, t.zero)
 		c.Assert(err, check.Equals, nil)
-		c.Check(func() { sv.SetRange(t.start-2, t.start, nil) }, check.Panics, ErrOutOfRange)
-		c.Check(func() { sv.SetRange(t.end, t.end+2, nil) }, check.Panics, ErrOutOfRange)
+		c.Check(func() { sv.SetRange(t.start-2, t.start, nil) }, check.Panics, &RangeError{Pos: t.start - 2, Start: t.start, End: t.end})
+		c.Check(func() { sv.SetRange(t.end, t.end+2, nil) }, check.Panics, &RangeError{Pos: t.end, Start: t.start, End: t.end})
 		for _, v := range t.sets {
 			sv.SetRange(v.start, v.end, v.val)
 			c.Check(sv.min.pos, check.Equals, t.start)
@@ -688,11 +829,50 @@ func (s *S) TestStepAt(c *check.C) {
 			c.Check(st, check.Equals, v.end)
 			c.Check(en, check.Equals, t.sets[i+1].start)
 		} else {
-			c.Check(err, check.ErrorMatches, ErrOutOfRange.Error())
+			c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
 		}
 	}
 	_, _, _, err = sv.StepAt(t.start - 1)
-	c.Check(err, check.ErrorMatches, ErrOutOfRange.Error())
+	c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
+}
+
+func (s *S) TestAtStep(c *check.C) {
+	sv, err := New(1, 20, Int(0))
+	c.Assert(err, check.Equals, nil)
+	for _, v := range []struct {
+		start, end int
+		val        Int
+	}{
+		{1, 3, 3},
+		{4, 5, 1},
+		{7, 12, 2},
+		{19, 20, 4},
+	} {
+		sv.SetRange(v.start, v.end, v.val)
+	}
+
+	var (
+		st    Step
+		moves int
+	)
+	for i := sv.Start(); i < sv.End(); i++ {
+		next, err := sv.AtStep(i, st)
+		c.Assert(err, check.Equals, nil)
+		at, _ := sv.At(i)
+		c.Check(next.Value, check.Equals, at)
+		c.Check(next.Contains(i), check.Equals, true)
+		start, end, _, _ := sv.StepAt(i)
+		c.Check(next, check.Equals, Step{Start: start, End: end, Value: at})
+		if next != st {
+			moves++
+		}
+		st = next
+	}
+	c.Check(moves, check.Equals, sv.Count())
+
+	st, err = sv.AtStep(sv.End(), st)
+	c.Check(st, check.Equals, Step{})
+	c.Check(err, check.DeepEquals, &RangeError{Pos: 20, Start: 1, End: 20})
 }
 
 func (s *S) TestDo(c *check.C) {
@@ -822,7 +1002,7 @@ func (s *S) TestDoRange(c *check.C) {
 			func(_, _ int, _ Equaler) {},
 			-2, -1,
 			[]Int(nil),
-			ErrOutOfRange,
+			&RangeError{Pos: -2, Start: 1, End: 10},
 		},
 		{1, 10, 0,
 			[]posRange{
@@ -852,6 +1032,289 @@ func (s *S) TestDoRange(c *check.C) {
 	}
 }
 
+type stepInterval struct {
+	start, end int
+	val        Equaler
+	id         uintptr
+}
+
+func (i *stepInterval) Overlap(r interval.IntRange) bool { return i.end > r.Start && i.start < r.End }
+func (i *stepInterval) ID() uintptr                      { return i.id }
+func (i *stepInterval) Range() interval.IntRange {
+	return interval.IntRange{Start: i.start, End: i.end}
+}
+
+func (s *S) TestToIntTree(c *check.C) {
+	rand.Seed(1)
+	for i := 0; i < 100; i++ {
+		sv, err := New(0, 100, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for j := 0; j < 10; j++ {
+			s := rand.Intn(100)
+			sv.SetRange(s, s+rand.Intn(100-s)+1, Int(rand.Intn(3)))
+		}
+		var id uintptr
+		t, err := sv.ToIntTree(func(start, end int, val Equaler) interval.IntInterface {
+			id++
+			return &stepInterval{start: start, end: end, val: val, id: id}
+		})
+		c.Assert(err, check.Equals, nil)
+		var nonZero int
+		sv.Do(func(_, _ int, e Equaler) {
+			if !e.Equal(sv.Zero) {
+				nonZero++
+			}
+		})
+		c.Check(t.Len(), check.Equals, nonZero)
+		for p := sv.Start(); p < sv.End(); p++ {
+			want, _ := sv.At(p)
+			got := t.Get(&stepInterval{start: p, end: p + 1})
+			if want.Equal(sv.Zero) {
+				c.Check(got, check.HasLen, 0, check.Commentf("position %d in %s", p, sv))
+				continue
+			}
+			c.Assert(got, check.HasLen, 1, check.Commentf("position %d in %s", p, sv))
+			c.Check(got[0].(*stepInterval).val, check.Equals, want)
+		}
+		// Range queries on the tree see the same non-Zero content as the vector.
+		for j := 0; j < 20; j++ {
+			from := rand.Intn(100)
+			to := from + rand.Intn(100-from) + 1
+			any, err := sv.AnyNonZero(from, to)
+			c.Assert(err, check.Equals, nil)
+			c.Check(len(t.Get(&stepInterval{start: from, end: to})) != 0, check.Equals, any)
+		}
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(2, 4, Int(1))
+	sv.SetRange(6, 8, Int(2))
+	var calls int
+	t, err := sv.ToIntTree(func(start, end int, val Equaler) interval.IntInterface {
+		calls++
+		return &stepInterval{start: end, end: start, val: val, id: uintptr(calls)}
+	})
+	c.Check(err, check.Equals, interval.ErrInvertedRange)
+	c.Check(t, check.IsNil)
+	c.Check(calls, check.Equals, 1)
+}
+
+func (s *S) TestCountRange(c *check.C) {
+	rand.Seed(1)
+	for i := 0; i < 20; i++ {
+		sv, err := New(0, 50, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for j := 0; j < 10; j++ {
+			s := rand.Intn(50)
+			sv.SetRange(s, s+rand.Intn(50-s)+1, Int(rand.Intn(3)))
+		}
+		for from := 0; from < 50; from++ {
+			for to := from + 1; to <= 50; to++ {
+				var want int
+				c.Assert(sv.DoRange(from, to, func(_, _ int, _ Equaler) { want++ }), check.Equals, nil)
+				got, err := sv.CountRange(from, to)
+				c.Check(err, check.Equals, nil)
+				c.Check(got, check.Equals, want, check.Commentf("[%d,%d) in %s", from, to, sv))
+			}
+		}
+		// Ranges overhanging the vector are clipped.
+		n, err := sv.CountRange(-5, 55)
+		c.Check(err, check.Equals, nil)
+		c.Check(n, check.Equals, sv.Count())
+		n, err = sv.CountRange(sv.Start(), sv.End())
+		c.Check(err, check.Equals, nil)
+		c.Check(n, check.Equals, sv.Count())
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	for _, t := range []struct {
+		from, to int
+		n        int
+		err      error
+	}{
+		{5, 5, 0, nil},
+		{10, 1, 0, ErrInvertedRange},
+		{-5, 0, 0, &RangeError{Pos: -5, Start: 0, End: 10}},
+		{10, 12, 0, &RangeError{Pos: 10, Start: 0, End: 10}},
+	} {
+		n, err := sv.CountRange(t.from, t.to)
+		c.Check(n, check.Equals, t.n)
+		c.Check(err, check.DeepEquals, t.err)
+	}
+}
+
+func (s *S) TestAnyNonZero(c *check.C) {
+	sv, err := New(1, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	for _, r := range []struct{ start, end, val int }{{1, 3, 3}, {4, 5, 1}, {7, 8, 2}, {9, 10, 4}} {
+		sv.SetRange(r.start, r.end, Int(r.val))
+	}
+	c.Assert(sv.String(), check.Equals, "[1:3 3:0 4:1 5:0 7:2 8:0 9:4 10:<nil>]")
+
+	for _, t := range []struct {
+		from, to int
+		any      bool
+		err      error
+	}{
+		{3, 4, false, nil},
+		{5, 7, false, nil},
+		{8, 9, false, nil},
+		{3, 5, true, nil},
+		{4, 5, true, nil},
+		{2, 3, true, nil},
+		{5, 8, true, nil},
+		{1, 10, true, nil},
+		{5, 5, false, nil},
+		{-5, 2, true, nil},
+		{8, 20, true, nil},
+		{-5, 1, false, &RangeError{Pos: -5, Start: 1, End: 10}},
+		{10, 12, false, &RangeError{Pos: 10, Start: 1, End: 10}},
+		{10, 1, false, ErrInvertedRange},
+	} {
+		any, err := sv.AnyNonZero(t.from, t.to)
+		c.Check(any, check.Equals, t.any, check.Commentf("[%d,%d)", t.from, t.to))
+		c.Check(err, check.DeepEquals, t.err, check.Commentf("[%d,%d)", t.from, t.to))
+	}
+
+	sv, err = New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	for from := 0; from < 10; from++ {
+		for to := from + 1; to <= 10; to++ {
+			sv.SetRange(0, 10, Int(0))
+			any, err := sv.AnyNonZero(from, to)
+			c.Check(err, check.Equals, nil)
+			c.Check(any, check.Equals, false)
+			for p := 0; p < 10; p++ {
+				sv.SetRange(0, 10, Int(0))
+				sv.Set(p, Int(1))
+				any, err := sv.AnyNonZero(from, to)
+				c.Check(err, check.Equals, nil)
+				c.Check(any, check.Equals, from <= p && p < to, check.Commentf("[%d,%d) with %d set", from, to, p))
+			}
+		}
+	}
+}
+
+func (s *S) TestStats(c *check.C) {
+	sv, err := New(1, 10, Float(0))
+	c.Assert(err, check.Equals, nil)
+	for _, r := range []struct {
+		start, end int
+		val        float64
+	}{{1, 3, 3}, {4, 5, -1.5}, {7, 8, 2}, {9, 10, 4}} {
+		sv.SetRange(r.start, r.end, Float(r.val))
+	}
+
+	const tol = 1e-12
+	for from := -2; from < 12; from++ {
+		for to := from + 1; to <= 12; to++ {
+			mean, variance, min, max, err := sv.Stats(from, to)
+			if to <= sv.Start() || from >= sv.End() {
+				c.Check(err, check.DeepEquals, &RangeError{Pos: from, Start: 1, End: 10})
+				continue
+			}
+			c.Assert(err, check.Equals, nil)
+
+			var vals []float64
+			for i := from; i < to; i++ {
+				if i < sv.Start() || i >= sv.End() {
+					continue
+				}
+				e, _ := sv.At(i)
+				vals = append(vals, float64(e.(Float)))
+			}
+			var sum float64
+			wantMin, wantMax := math.Inf(1), math.Inf(-1)
+			for _, x := range vals {
+				sum += x
+				wantMin = math.Min(wantMin, x)
+				wantMax = math.Max(wantMax, x)
+			}
+			wantMean := sum / float64(len(vals))
+			var ss float64
+			for _, x := range vals {
+				ss += (x - wantMean) * (x - wantMean)
+			}
+			wantVariance := ss / float64(len(vals))
+
+			comment := check.Commentf("[%d,%d)", from, to)
+			c.Check(math.Abs(mean-wantMean) <= tol, check.Equals, true, comment)
+			c.Check(math.Abs(variance-wantVariance) <= tol, check.Equals, true, comment)
+			c.Check(min, check.Equals, wantMin, comment)
+			c.Check(max, check.Equals, wantMax, comment)
+		}
+	}
+
+	_, _, _, _, err = sv.Stats(5, 4)
+	c.Check(err, check.Equals, ErrInvertedRange)
+	mean, variance, min, max, err := sv.Stats(5, 5)
+	c.Check(err, check.Equals, nil)
+	for _, v := range []float64{mean, variance, min, max} {
+		c.Check(math.IsNaN(v), check.Equals, true)
+	}
+
+	sv.Set(8, Float(math.NaN()))
+	mean, variance, min, max, err = sv.Stats(1, 10)
+	c.Check(err, check.Equals, nil)
+	for _, v := range []float64{mean, variance, min, max} {
+		c.Check(math.IsNaN(v), check.Equals, true)
+	}
+
+	iv, err := New(0, 4, Int(2))
+	c.Assert(err, check.Equals, nil)
+	iv.SetRange(2, 4, Int(6))
+	mean, variance, min, max, err = iv.Stats(0, 4)
+	c.Check(err, check.Equals, nil)
+	c.Check([]float64{mean, variance, min, max}, check.DeepEquals, []float64{4, 4, 2, 6})
+
+	pv, err := New(0, 4, pair{})
+	c.Assert(err, check.Equals, nil)
+	_, _, _, _, err = pv.Stats(0, 4)
+	c.Check(err, check.Equals, ErrTypeMismatch)
+}
+
+func (s *S) TestFindFirstLast(c *check.C) {
+	rand.Seed(1)
+	const start, end = 0, 50
+	for i := 0; i < 200; i++ {
+		sv, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for j := rand.Intn(10); j >= 0; j-- {
+			s := rand.Intn(end - start)
+			sv.SetRange(s, s+rand.Intn(end-s)+1, Int(rand.Intn(5)))
+		}
+		for threshold := Int(-1); threshold < 5; threshold++ {
+			above := func(e Equaler) bool { return e.(Int) > threshold }
+			var (
+				first, last int
+				found       bool
+			)
+			for p := start; p < end; p++ {
+				e, _ := sv.At(p)
+				if above(e) {
+					if !found {
+						first = p
+					}
+					last = p
+					found = true
+				}
+			}
+			pos, ok := sv.FindFirst(above)
+			c.Check(ok, check.Equals, found, check.Commentf("threshold %d: %s", threshold, sv))
+			if found {
+				c.Check(pos, check.Equals, first, check.Commentf("threshold %d: %s", threshold, sv))
+			}
+			pos, ok = sv.FindLast(above)
+			c.Check(ok, check.Equals, found, check.Commentf("threshold %d: %s", threshold, sv))
+			if found {
+				c.Check(pos, check.Equals, last, check.Commentf("threshold %d: %s", threshold, sv))
+			}
+		}
+	}
+}
+
 func (s *S) TestApply(c *check.C) {
 	type posRange struct {
 		start, end int
@@ -925,6 +1388,197 @@ func (s *S) TestApply(c *check.C) {
 	}
 }
 
+func (s *S) TestApplyCounting(c *check.C) {
+	for i, t := range []struct {
+		mutate  Mutator
+		changed int
+		expect  string
+	}{
+		{
+			func(e Equaler) Equaler { return e },
+			0,
+			"[1:3 3:0 4:1 5:0 7:2 8:0 9:4 10:<nil>]",
+		},
+		{
+			IncInt,
+			7,
+			"[1:4 3:1 4:2 5:1 7:3 8:1 9:5 10:<nil>]",
+		},
+		{
+			func(_ Equaler) Equaler { return Int(0) },
+			4,
+			"[1:0 10:<nil>]",
+		},
+		{
+			func(e Equaler) Equaler {
+				if e.(Int) > 2 {
+					return Int(2)
+				}
+				return e
+			},
+			2,
+			"[1:2 3:0 4:1 5:0 7:2 8:0 9:2 10:<nil>]",
+		},
+	} {
+		sv, err := New(1, 10, Int(0))
+		c.Assert(err, check.Equals, nil)
+		sv.SetRange(1, 3, Int(3))
+		sv.SetRange(4, 5, Int(1))
+		sv.SetRange(7, 8, Int(2))
+		sv.SetRange(9, 10, Int(4))
+		c.Check(sv.ApplyCounting(t.mutate), check.Equals, t.changed, check.Commentf("subtest %d", i))
+		c.Check(sv.String(), check.Equals, t.expect, check.Commentf("subtest %d", i))
+	}
+}
+
+func (s *S) TestApplyRangeBoundaries(c *check.C) {
+	rand.Seed(1)
+	const start, end = 0, 20
+	for i := 0; i < 200; i++ {
+		var edits [][3]int
+		for j := 0; j < 5; j++ {
+			s := rand.Intn(end)
+			edits = append(edits, [3]int{s, s + rand.Intn(end-s) + 1, rand.Intn(3)})
+		}
+		for _, r := range [][2]int{{start, end}, {start, end - 1}, {start + 1, end}, {start + 1, end - 1}, {-2, end + 2}, {-2, end / 2}} {
+			for _, m := range []Mutator{
+				IncInt,
+				func(e Equaler) Equaler { return Int(0) },
+				func(e Equaler) Equaler { return e.(Int) % 2 },
+			} {
+				sv, err := New(start, end, Int(0))
+				c.Assert(err, check.Equals, nil)
+				v := newVector(start, end, end, Int(0))
+				for _, e := range edits {
+					sv.SetRange(e[0], e[1], Int(e[2]))
+					v.setRange(e[0], e[1], Int(e[2]))
+				}
+				was := sv.String()
+				c.Check(sv.ApplyRange(r[0], r[1], m), check.Equals, nil)
+				clipped := r
+				if clipped[0] < start {
+					clipped[0] = start
+				}
+				if clipped[1] > end {
+					clipped[1] = end
+				}
+				v.applyRange(clipped[0], clipped[1], m)
+				c.Check(v.aggreesWith(sv), check.Equals, true,
+					check.Commentf("apply over %v:\nwas:   %s\nstep:  %s\narray: %s", r, was, sv, v))
+				c.Check(sv.min, check.DeepEquals, sv.t.Min())
+				c.Check(sv.max, check.DeepEquals, sv.t.Max())
+				var last Equaler
+				sv.Do(func(_, _ int, e Equaler) {
+					if last != nil {
+						c.Check(e.Equal(last), check.Equals, false, check.Commentf("apply over %v: %s", r, sv))
+					}
+					last = e
+				})
+			}
+		}
+	}
+}
+
+func (s *S) TestApplyRangeCoalescing(c *check.C) {
+	// Each case applies a mutator that makes the first mutated step
+	// equal to its left neighbour.
+	toOne := func(e Equaler) Equaler {
+		if e.(Int) == 2 {
+			return Int(1)
+		}
+		return e
+	}
+	for i, t := range []struct {
+		relaxed  bool
+		sets     [][3]int
+		from, to int
+		m        Mutator
+		expect   string
+	}{
+		{false, [][3]int{{0, 2, 1}, {2, 4, 2}}, 2, 5, toOne, "[0:1 4:0 10:<nil>]"},
+		{false, [][3]int{{0, 2, 1}, {2, 4, 2}}, 2, 3, toOne, "[0:1 3:2 4:0 10:<nil>]"},
+		{false, [][3]int{{0, 2, 1}, {2, 4, 2}}, 2, 4, toOne, "[0:1 4:0 10:<nil>]"},
+		{false, [][3]int{{0, 2, 1}, {2, 4, 2}, {4, 6, 1}}, 2, 8, toOne, "[0:1 6:0 10:<nil>]"},
+		{false, [][3]int{{0, 2, 1}, {2, 4, 0}}, 2, 6, IncInt, "[0:1 6:0 10:<nil>]"},
+		{false, [][3]int{{2, 4, 1}}, 4, 6, IncInt, "[0:0 2:1 6:0 10:<nil>]"},
+		{true, [][3]int{{3, 10, 2}}, -5, 6, IncInt, "[-5:1 3:3 6:2 10:<nil>]"},
+		{true, [][3]int{{3, 10, 2}}, -5, 3, IncInt, "[-5:1 3:2 10:<nil>]"},
+		{true, [][3]int{{0, 3, 1}, {3, 10, 2}}, -5, 4, toOne, "[-5:0 0:1 4:2 10:<nil>]"},
+		{true, [][3]int{{0, 10, 1}}, -1, 1, IncInt, "[-1:1 0:2 1:1 10:<nil>]"},
+		{true, [][3]int{{0, 2, 1}, {2, 10, 2}}, -1, 1, IncInt, "[-1:1 0:2 1:1 2:2 10:<nil>]"},
+	} {
+		sv, err := New(0, 10, Int(0))
+		c.Assert(err, check.Equals, nil)
+		sv.Relaxed = t.relaxed
+		for _, e := range t.sets {
+			sv.SetRange(e[0], e[1], Int(e[2]))
+		}
+		c.Check(sv.ApplyRange(t.from, t.to, t.m), check.Equals, nil)
+		c.Check(sv.String(), check.Equals, t.expect, check.Commentf("subtest %d", i))
+	}
+
+	sv, err := New(2, 5, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.Relaxed = true
+	sv.SetRange(2, 5, Int(1))
+	c.Check(sv.ApplyRange(1, 3, IncInt), check.Equals, nil)
+	c.Check(sv.String(), check.Equals, "[1:1 2:2 3:1 5:<nil>]")
+
+	rand.Seed(1)
+	const start, end = 0, 20
+	for i := 0; i < 5000; i++ {
+		sv, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		sv.Relaxed = true
+		for j := 0; j < 5; j++ {
+			s := rand.Intn(end)
+			sv.SetRange(s, s+rand.Intn(end-s)+1, Int(rand.Intn(3)))
+		}
+		from := rand.Intn(end+10) - 5
+		to := from + rand.Intn(end+10-from) + 1
+		target, val := Int(rand.Intn(3)), Int(rand.Intn(3))
+		m := func(e Equaler) Equaler {
+			if e.(Int) == target {
+				return val
+			}
+			return e
+		}
+		if rand.Intn(2) == 0 {
+			target, m = -1, IncInt
+		}
+
+		lo, hi := sv.Start(), sv.End()
+		if from < lo {
+			lo = from
+		}
+		if to > hi {
+			hi = to
+		}
+		want := make([]Equaler, hi-lo)
+		for p := range want {
+			e, err := sv.At(p + lo)
+			if err != nil {
+				e = sv.Zero
+			}
+			if p+lo >= from && p+lo < to {
+				e = m(e)
+			}
+			want[p] = e
+		}
+		was := sv.String()
+
+		c.Check(sv.ApplyRange(from, to, m), check.Equals, nil)
+		fresh, err := New(lo, hi, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for p, e := range want {
+			fresh.SetRange(p+lo, p+lo+1, e)
+		}
+		c.Check(sv.String(), check.Equals, fresh.String(),
+			check.Commentf("apply %d over [%d,%d) to %s", target, from, to, was))
+		c.Check(sv.Count(), check.Equals, fresh.Count())
+	}
+}
+
 func (s *S) TestMutateRange(c *check.C) {
 	type posRange struct {
 		start, end int
@@ -1047,7 +1701,7 @@ func (s *S) TestMutateRange(c *check.C) {
 			IncInt,
 			-1, 0,
 			"[1:3 3:0 4:1 5:0 7:2 8:0 9:4 10:<nil>]",
-			ErrOutOfRange,
+			&RangeError{Pos: -1, Start: 1, End: 10},
 		},
 		{1, 10, 0,
 			[]posRange{
@@ -1283,6 +1937,364 @@ func (s *S) TestMutatorSetting(c *check.C) {
 	}
 }
 
+func (s *S) TestAddRange(c *check.C) {
+	for i, t := range []struct {
+		zero, delta Equaler
+		add         func(a, b Equaler) Equaler
+	}{
+		{Int(0), Int(3), func(a, b Equaler) Equaler { return a.(Int) + b.(Int) }},
+		{Int(0), Int(-2), func(a, b Equaler) Equaler { return a.(Int) + b.(Int) }},
+		{Float(0), Float(0.5), func(a, b Equaler) Equaler { return a.(Float) + b.(Float) }},
+	} {
+		rand.Seed(int64(i))
+		sv, err := New(0, 1, t.zero)
+		c.Assert(err, check.Equals, nil)
+		sv.Relaxed = true
+		av := newVector(0, 1, 120, t.zero)
+		for j := 0; j < 1000; j++ {
+			s := rand.Intn(100)
+			l := rand.Intn(20)
+			c.Check(sv.AddRange(s, s+l, t.delta), check.Equals, nil)
+			if l != 0 {
+				if s < av.min {
+					av.min = s
+				}
+				if s+l > av.max {
+					av.max = s + l
+				}
+			}
+			for k := s; k < s+l; k++ {
+				av.data[k] = t.add(av.data[k], t.delta)
+			}
+			c.Assert(av.aggreesWith(sv), check.Equals, true,
+				check.Commentf("subtest %d iteration %d:\ngot: %v\nwant:%v", i, j, sv, av))
+			var last Equaler
+			sv.Do(func(_, _ int, e Equaler) {
+				c.Check(e != last, check.Equals, true, check.Commentf("subtest %d iteration %d: uncoalesced %v", i, j, sv))
+				last = e
+			})
+		}
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(sv.AddRange(2, 5, pair{}), check.Equals, ErrTypeMismatch)
+	c.Check(sv.AddRange(2, 5, Float(1)), check.Equals, ErrTypeMismatch)
+	c.Check(sv.AddRange(5, 2, Int(1)), check.Equals, ErrInvertedRange)
+	c.Check(sv.AddRange(2, 5, Int(1)), check.Equals, nil)
+	c.Check(sv.String(), check.Equals, "[0:0 2:1 5:0 10:<nil>]")
+
+	fv, err := New(0, 10, Float(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(fv.AddRange(2, 5, Int(1)), check.Equals, ErrTypeMismatch)
+	c.Check(fv.String(), check.Equals, "[0:0 10:<nil>]")
+	fv.Relaxed = true
+	fv.Zero = Int(0)
+	c.Check(fv.AddRange(-2, 5, Float(1)), check.Equals, ErrTypeMismatch)
+	c.Check(fv.AddRange(5, 12, Float(1)), check.Equals, ErrTypeMismatch)
+	c.Check(fv.String(), check.Equals, "[0:0 10:<nil>]")
+	c.Check(fv.AddRange(2, 5, Float(1)), check.Equals, nil)
+	c.Check(fv.String(), check.Equals, "[0:0 2:1 5:0 10:<nil>]")
+
+	// Place a Float step within an Int Vector directly since
+	// SetRange cannot compare values of different types.
+	mv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	mv.t.Insert(&position{pos: 4, val: Float(1)})
+	mv.t.Insert(&position{pos: 6, val: Int(0)})
+	c.Assert(mv.String(), check.Equals, "[0:0 4:1 6:0 10:<nil>]")
+	c.Check(mv.AddRange(2, 8, Int(1)), check.Equals, ErrTypeMismatch)
+	c.Check(mv.AddRange(5, 6, Int(1)), check.Equals, ErrTypeMismatch)
+	c.Check(mv.String(), check.Equals, "[0:0 4:1 6:0 10:<nil>]")
+}
+
+func (s *S) TestIntegrate(c *check.C) {
+	for i, zero := range []Equaler{Int(0), Float(0)} {
+		rand.Seed(int64(i))
+		sv, err := New(-5, 100, zero)
+		c.Assert(err, check.Equals, nil)
+		for j := 0; j < 20; j++ {
+			s := rand.Intn(90) - 5
+			l := rand.Intn(15)
+			var e Equaler
+			switch zero.(type) {
+			case Int:
+				e = Int(rand.Intn(5) - 2)
+			case Float:
+				e = Float(rand.Intn(5)-2) / 2
+			}
+			sv.SetRange(s, s+l, e)
+		}
+		iv, err := sv.Integrate()
+		c.Assert(err, check.Equals, nil)
+		c.Check(iv.Start(), check.Equals, sv.Start())
+		c.Check(iv.End(), check.Equals, sv.End())
+		c.Check(iv.Zero, check.Equals, zero)
+		var (
+			isum Int
+			fsum Float
+		)
+		for p := sv.Start(); p < sv.End(); p++ {
+			e, _ := sv.At(p)
+			got, err := iv.At(p)
+			c.Check(err, check.Equals, nil)
+			switch e := e.(type) {
+			case Int:
+				isum += e
+				c.Check(got, check.Equals, isum, check.Commentf("subtest %d position %d", i, p))
+			case Float:
+				fsum += e
+				c.Check(got, check.Equals, fsum, check.Commentf("subtest %d position %d", i, p))
+			}
+		}
+		var last Equaler
+		iv.Do(func(_, _ int, e Equaler) {
+			if last != nil {
+				c.Check(e.Equal(last), check.Equals, false)
+			}
+			last = e
+		})
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(2, 4, Int(2))
+	sv.SetRange(6, 7, Int(-1))
+	iv, err := sv.Integrate()
+	c.Assert(err, check.Equals, nil)
+	c.Check(iv.String(), check.Equals, "[0:0 2:2 3:4 6:3 10:<nil>]")
+
+	sv, err = New(0, 10, pair{})
+	c.Assert(err, check.Equals, nil)
+	_, err = sv.Integrate()
+	c.Check(err, check.Equals, ErrTypeMismatch)
+}
+
+func (s *S) TestEqualApprox(c *check.C) {
+	type posRange struct {
+		start, end int
+		val        Equaler
+	}
+	for i, t := range []struct {
+		start, end int
+		zero       Equaler
+		a, b       []posRange
+		eps        float64
+		expect     bool
+	}{
+		{0, 10, Float(0), nil, nil, 0, true},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(1)}, {5, 8, Float(math.NaN())}},
+			[]posRange{{2, 5, Float(1 + 1e-12)}, {5, 8, Float(math.NaN())}},
+			1e-9, true,
+		},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(1)}},
+			[]posRange{{2, 5, Float(1 + 1e-6)}},
+			1e-9, false,
+		},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(1)}, {5, 8, Float(1 + 1e-12)}},
+			[]posRange{{2, 8, Float(1)}},
+			1e-9, true,
+		},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(1)}},
+			[]posRange{{2, 6, Float(1)}},
+			1e-9, false,
+		},
+		{0, 10, Float(0),
+			[]posRange{{0, 10, Float(math.Inf(1))}},
+			[]posRange{{0, 10, Float(math.Inf(1))}},
+			0, true,
+		},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(math.NaN())}},
+			[]posRange{{2, 5, Float(0)}},
+			1e-9, false,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}},
+			[]posRange{{2, 5, Int(1)}},
+			0, true,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}},
+			[]posRange{{2, 5, Int(2)}},
+			10, false,
+		},
+	} {
+		a, err := New(t.start, t.end, t.zero)
+		c.Assert(err, check.Equals, nil)
+		for _, v := range t.a {
+			a.SetRange(v.start, v.end, v.val)
+		}
+		b, err := New(t.start, t.end, t.zero)
+		c.Assert(err, check.Equals, nil)
+		for _, v := range t.b {
+			b.SetRange(v.start, v.end, v.val)
+		}
+		c.Check(a.EqualApprox(b, t.eps), check.Equals, t.expect, check.Commentf("subtest %d", i))
+		c.Check(b.EqualApprox(a, t.eps), check.Equals, t.expect, check.Commentf("subtest %d", i))
+	}
+
+	a, err := New(0, 10, Float(0))
+	c.Assert(err, check.Equals, nil)
+	b, err := New(0, 11, Float(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(a.EqualApprox(b, 1), check.Equals, false)
+}
+
+func (s *S) TestHash(c *check.C) {
+	type posRange struct {
+		start, end int
+		val        Equaler
+	}
+	for i, t := range []struct {
+		start, end int
+		zero       Equaler
+		a, b       []posRange
+		expect     bool
+	}{
+		{0, 10, Int(0), nil, nil, true},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}, {5, 8, Int(1)}},
+			[]posRange{{2, 8, Int(1)}},
+			true,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}, {3, 4, Int(2)}},
+			[]posRange{{2, 3, Int(1)}, {4, 5, Int(1)}, {3, 4, Int(2)}},
+			true,
+		},
+		{0, 10, Float(0),
+			[]posRange{{2, 5, Float(math.NaN())}, {5, 8, Float(0)}},
+			[]posRange{{2, 5, Float(math.NaN())}, {5, 8, Float(math.Copysign(0, -1))}},
+			true,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}},
+			[]posRange{{2, 5, Int(2)}},
+			false,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}},
+			[]posRange{{2, 6, Int(1)}},
+			false,
+		},
+		{0, 10, Int(0),
+			[]posRange{{2, 5, Int(1)}},
+			[]posRange{{3, 5, Int(1)}},
+			false,
+		},
+	} {
+		a, err := New(t.start, t.end, t.zero)
+		c.Assert(err, check.Equals, nil)
+		for _, v := range t.a {
+			a.SetRange(v.start, v.end, v.val)
+		}
+		b, err := New(t.start, t.end, t.zero)
+		c.Assert(err, check.Equals, nil)
+		for _, v := range t.b {
+			b.SetRange(v.start, v.end, v.val)
+		}
+		c.Check(a.Hash() == b.Hash(), check.Equals, t.expect, check.Commentf("subtest %d", i))
+		c.Check(a.Hash(), check.Equals, a.Hash(), check.Commentf("subtest %d", i))
+	}
+
+	a, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	b, err := New(0, 11, Int(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(a.Hash() == b.Hash(), check.Equals, false)
+	b, err = New(0, 10, Int(1))
+	c.Assert(err, check.Equals, nil)
+	c.Check(a.Hash() == b.Hash(), check.Equals, false)
+}
+
+func (s *S) TestRecode(c *check.C) {
+	sv, err := New(1, 20, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.Relaxed = true
+	for _, v := range []struct {
+		start, end int
+		val        Int
+	}{
+		{1, 3, 3},
+		{3, 5, 1},
+		{7, 12, 2},
+		{12, 15, 4},
+		{19, 20, 5},
+	} {
+		sv.SetRange(v.start, v.end, v.val)
+	}
+	c.Assert(sv.String(), check.Equals, "[1:3 3:1 5:0 7:2 12:4 15:0 19:5 20:<nil>]")
+
+	r := sv.Recode(map[Equaler]Equaler{Int(0): Int(10), Int(1): Int(3), Int(3): Int(3), Int(2): Int(4), Int(4): Int(4)}, Int(-1))
+	c.Check(r.String(), check.Equals, "[1:3 5:10 7:4 15:10 19:-1 20:<nil>]")
+	c.Check(r.Zero, check.Equals, Int(10))
+	c.Check(r.Relaxed, check.Equals, true)
+	c.Check(r.min, check.Equals, r.t.Min())
+	c.Check(r.max, check.Equals, r.t.Max())
+	c.Check(sv.String(), check.Equals, "[1:3 3:1 5:0 7:2 12:4 15:0 19:5 20:<nil>]")
+
+	r = sv.RecodeFunc(func(e Equaler) Equaler { return Int(0) })
+	c.Check(r.String(), check.Equals, "[1:0 20:<nil>]")
+	c.Check(r.Count(), check.Equals, 1)
+
+	r = sv.RecodeFunc(func(e Equaler) Equaler { return pair{e.(Int)&1 != 0, false} })
+	c.Check(r.String(), check.Equals, "[1:[true false] 5:[false false] 19:[true false] 20:<nil>]")
+	c.Check(r.Zero, check.Equals, pair{})
+}
+
+func (s *S) TestSplit(c *check.C) {
+	sv, err := New(-5, 50, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(0, 10, Int(1))
+	sv.SetRange(10, 20, Int(2))
+	sv.SetRange(30, 31, Int(3))
+	orig := sv.String()
+	for p := sv.Start() + 1; p < sv.End(); p++ {
+		l, r, err := sv.Split(p)
+		c.Assert(err, check.Equals, nil)
+		c.Check(l.Start(), check.Equals, sv.Start())
+		c.Check(l.End(), check.Equals, p)
+		c.Check(r.Start(), check.Equals, p)
+		c.Check(r.End(), check.Equals, sv.End())
+		c.Check(l.min, check.DeepEquals, l.t.Min())
+		c.Check(r.min, check.DeepEquals, r.t.Min())
+
+		j, err := New(l.Start(), r.End(), sv.Zero)
+		c.Assert(err, check.Equals, nil)
+		l.Do(func(start, end int, e Equaler) { j.SetRange(start, end, e) })
+		r.Do(func(start, end int, e Equaler) { j.SetRange(start, end, e) })
+		c.Check(j.String(), check.Equals, orig, check.Commentf("split at %d", p))
+
+		// The halves are independent of the original.
+		l.SetRange(l.Start(), l.End(), Int(9))
+		r.SetRange(r.Start(), r.End(), Int(9))
+		c.Check(sv.String(), check.Equals, orig)
+	}
+
+	l, r, err := sv.Split(10)
+	c.Assert(err, check.Equals, nil)
+	c.Check(l.String(), check.Equals, "[-5:0 0:1 10:<nil>]")
+	c.Check(r.String(), check.Equals, "[10:2 20:0 30:3 31:0 50:<nil>]")
+	l, r, err = sv.Split(5)
+	c.Assert(err, check.Equals, nil)
+	c.Check(l.String(), check.Equals, "[-5:0 0:1 5:<nil>]")
+	c.Check(r.String(), check.Equals, "[5:1 10:2 20:0 30:3 31:0 50:<nil>]")
+
+	for _, p := range []int{-5, 50} {
+		_, _, err = sv.Split(p)
+		c.Check(err, check.Equals, ErrZeroLength)
+	}
+	for _, p := range []int{-6, 51} {
+		_, _, err = sv.Split(p)
+		c.Check(errors.Is(err, ErrOutOfRange), check.Equals, true)
+	}
+}
+
 type vector struct {
 	min, max int
 	data     []Equaler
@@ -1361,6 +2373,127 @@ func (v *vector) String() string {
 	return buf.String()
 }
 
+func (s *S) TestDownsample(c *check.C) {
+	v, err := New(0, 10, Float(0))
+	c.Assert(err, check.Equals, nil)
+	v.SetRange(2, 5, Float(4))
+	v.SetRange(7, 10, Float(1))
+	mean := func(vals []WeightedValue) Equaler {
+		var sum float64
+		var n int
+		for _, w := range vals {
+			sum += float64(w.Width) * float64(w.Val.(Float))
+			n += w.Width
+		}
+		return Float(sum / float64(n))
+	}
+
+	_, err = v.Downsample(0, mean)
+	c.Check(err, check.Equals, ErrBinWidth)
+
+	for _, width := range []int{1, 2, 3, 4, 5, 10, 20} {
+		d, err := v.Downsample(width, mean)
+		c.Assert(err, check.Equals, nil)
+		c.Check(d.Start(), check.Equals, v.Start())
+		c.Check(d.End(), check.Equals, v.End())
+		for start := v.Start(); start < v.End(); start += width {
+			end := start + width
+			if end > v.End() {
+				end = v.End()
+			}
+			var sum float64
+			for i := start; i < end; i++ {
+				e, _ := v.At(i)
+				sum += float64(e.(Float))
+			}
+			want := Float(sum / float64(end-start))
+			for i := start; i < end; i++ {
+				got, err := d.At(i)
+				c.Check(err, check.Equals, nil)
+				c.Check(got, check.Equals, want, check.Commentf("width %d position %d", width, i))
+			}
+		}
+	}
+
+	d, err := v.Downsample(4, mean)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "[0:2 4:1.25 8:1 10:<nil>]")
+}
+
+func (s *S) TestResample(c *check.C) {
+	v, err := New(0, 10, Float(0))
+	c.Assert(err, check.Equals, nil)
+	v.SetRange(2, 5, Float(4))
+	v.SetRange(7, 10, Float(1))
+	mean := func(vals []WeightedValue) Equaler {
+		var sum float64
+		var n int
+		for _, w := range vals {
+			sum += float64(w.Width) * float64(w.Val.(Float))
+			n += w.Width
+		}
+		return Float(sum / float64(n))
+	}
+	at := func(i int) float64 {
+		if i < v.Start() || i >= v.End() {
+			return float64(v.Zero.(Float))
+		}
+		e, _ := v.At(i)
+		return float64(e.(Float))
+	}
+
+	_, err = v.Resample(0, 10, 0, mean)
+	c.Check(err, check.Equals, ErrBinWidth)
+	_, err = v.Resample(5, 5, 1, mean)
+	c.Check(err, check.Equals, ErrZeroLength)
+
+	for _, t := range []struct{ start, end, stride int }{
+		{0, 10, 1},
+		{0, 10, 3},
+		{0, 10, 20},
+		{1, 9, 2},
+		{3, 8, 4},
+		{-4, 14, 3},
+		{-4, 14, 5},
+		{12, 20, 3},
+	} {
+		d, err := v.Resample(t.start, t.end, t.stride, mean)
+		c.Assert(err, check.Equals, nil)
+		c.Check(d.Start(), check.Equals, t.start)
+		c.Check(d.End(), check.Equals, t.end)
+		for start := t.start; start < t.end; start += t.stride {
+			end := start + t.stride
+			if end > t.end {
+				end = t.end
+			}
+			var sum float64
+			for i := start; i < end; i++ {
+				sum += at(i)
+			}
+			want := Float(sum / float64(end-start))
+			for i := start; i < end; i++ {
+				got, err := d.At(i)
+				c.Check(err, check.Equals, nil)
+				c.Check(got, check.Equals, want, check.Commentf("resample %+v position %d", t, i))
+			}
+		}
+	}
+
+	d, err := v.Resample(0, 10, 5, mean)
+	c.Assert(err, check.Equals, nil)
+	c.Check(d.String(), check.Equals, "[0:2.4 5:0.6 10:<nil>]")
+
+	// Upsampling onto a finer grid gives each bin the single value covering it.
+	var counts []int
+	d, err = v.Resample(1, 6, 1, func(vals []WeightedValue) Equaler {
+		counts = append(counts, len(vals))
+		return vals[0].Val
+	})
+	c.Assert(err, check.Equals, nil)
+	c.Check(counts, check.DeepEquals, []int{1, 1, 1, 1, 1})
+	c.Check(d.String(), check.Equals, "[1:0 2:4 5:0 6:<nil>]")
+}
+
 func (s *S) TestMutateRangePartialFuzzing(c *check.C) {
 	rand.Seed(1)
 	sv, err := New(0, 1, pair{})
@@ -1408,6 +2541,350 @@ func (s *S) TestMutateRangePartialFuzzing(c *check.C) {
 	}
 }
 
+func (s *S) TestSetRangeUnchanged(c *check.C) {
+	sv, err := New(0, 100, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(10, 20, Int(1))
+	sv.SetRange(40, 60, Int(2))
+	steps := func() (p []*position) {
+		sv.t.Do(func(e llrb.Comparable) (done bool) { p = append(p, e.(*position)); return })
+		return p
+	}
+	before := steps()
+	for _, r := range []struct {
+		start, end int
+		val        Equaler
+	}{
+		{0, 10, Int(0)},
+		{12, 18, Int(1)},
+		{10, 20, Int(1)},
+		{20, 40, Int(0)},
+		{45, 46, Int(2)},
+		{60, 100, Int(0)},
+	} {
+		sv.SetRange(r.start, r.end, r.val)
+		c.Check(steps(), check.DeepEquals, before, check.Commentf("set [%d,%d) to %v", r.start, r.end, r.val))
+	}
+	c.Check(sv.String(), check.Equals, "[0:0 10:1 20:0 40:2 60:0 100:<nil>]")
+
+	sv.SetRange(15, 45, Int(1))
+	c.Check(sv.String(), check.Equals, "[0:0 10:1 45:2 60:0 100:<nil>]")
+	sv.SetRange(5, 62, Int(2))
+	c.Check(sv.String(), check.Equals, "[0:0 5:2 62:0 100:<nil>]")
+}
+
+func (s *S) TestSetRangeFunc(c *check.C) {
+	rand.Seed(1)
+	for _, relaxed := range []bool{false, true} {
+		for i := 0; i < 500; i++ {
+			const start, end = 0, 50
+			var ranges []Step
+			for j := rand.Intn(10); j >= 0; j-- {
+				s := rand.Intn(end - start)
+				e := s + rand.Intn(end-s+1)
+				if relaxed {
+					s -= rand.Intn(5)
+					e += rand.Intn(5)
+				}
+				ranges = append(ranges, Step{Start: s, End: e, Value: Int(rand.Intn(3))})
+			}
+
+			want, err := New(start, end, Int(0))
+			c.Assert(err, check.Equals, nil)
+			want.Relaxed = relaxed
+			want.SetRange(10, 20, Int(1))
+			got, err := New(start, end, Int(0))
+			c.Assert(err, check.Equals, nil)
+			got.Relaxed = relaxed
+			got.SetRange(10, 20, Int(1))
+
+			for _, r := range ranges {
+				want.SetRange(r.Start, r.End, r.Value)
+			}
+			c.Check(got.SetRangeFunc(ranges), check.Equals, nil)
+			c.Check(got.String(), check.Equals, want.String(), check.Commentf("ranges: %v", ranges))
+			c.Check(got.min, check.DeepEquals, got.t.Min())
+			c.Check(got.max, check.DeepEquals, got.t.Max())
+		}
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(2, 4, Int(1))
+	was := sv.String()
+	for _, t := range []struct {
+		ranges []Step
+		err    error
+	}{
+		{[]Step{{0, 2, Int(1)}, {5, 3, Int(1)}}, ErrInvertedRange},
+		{[]Step{{0, 2, Int(1)}, {-1, 3, Int(1)}}, &RangeError{Pos: -1, Start: 0, End: 10}},
+		{[]Step{{0, 2, Int(1)}, {8, 12, Int(1)}}, &RangeError{Pos: 10, Start: 0, End: 10}},
+		{[]Step{{10, 10, Int(1)}}, &RangeError{Pos: 10, Start: 0, End: 10}},
+	} {
+		c.Check(sv.SetRangeFunc(t.ranges), check.DeepEquals, t.err)
+		c.Check(sv.String(), check.Equals, was)
+	}
+	c.Check(sv.SetRangeFunc(nil), check.Equals, nil)
+	c.Check(sv.SetRangeFunc([]Step{{0, 2, Int(1)}, {4, 6, Int(1)}, {5, 8, Int(2)}, {6, 7, Int(3)}}), check.Equals, nil)
+	c.Check(sv.String(), check.Equals, "[0:1 5:2 6:3 7:2 8:0 10:<nil>]")
+}
+
+func (s *S) TestOverlay(c *check.C) {
+	rand.Seed(1)
+	const start, end = 0, 50
+	for i := 0; i < 200; i++ {
+		base, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for j := 0; j < 10; j++ {
+			s := rand.Intn(end - start)
+			base.SetRange(s, s+rand.Intn(end-s)+1, Int(rand.Intn(3)))
+		}
+		b, err := New(start+5, end-5, Int(-1))
+		c.Assert(err, check.Equals, nil)
+		for j := rand.Intn(4); j >= 0; j-- {
+			s := rand.Intn(b.End()-b.Start()) + b.Start()
+			b.SetRange(s, s+rand.Intn(b.End()-s)+1, Int(rand.Intn(4)-1))
+		}
+
+		got, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		base.Do(func(start, end int, e Equaler) { got.SetRange(start, end, e) })
+		c.Assert(got.Overlay(b), check.Equals, nil)
+		for p := start; p < end; p++ {
+			want, _ := base.At(p)
+			if p >= b.Start() && p < b.End() {
+				if e, _ := b.At(p); !e.Equal(b.Zero) {
+					want = e
+				}
+			}
+			e, _ := got.At(p)
+			c.Check(e, check.Equals, want, check.Commentf("position %d base %s overlay %s", p, base, b))
+		}
+		var last Equaler
+		got.Do(func(_, _ int, e Equaler) {
+			c.Check(last != nil && e.Equal(last), check.Equals, false, check.Commentf("non-minimal: %s", got))
+			last = e
+		})
+	}
+
+	sv, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	sv.SetRange(2, 4, Int(1))
+	was := sv.String()
+	b, err := New(-5, 15, Int(0))
+	c.Assert(err, check.Equals, nil)
+	b.SetRange(5, 6, Int(2))
+	b.SetRange(8, 12, Int(3))
+	c.Check(sv.Overlay(b), check.DeepEquals, &RangeError{Pos: 10, Start: 0, End: 10})
+	c.Check(sv.String(), check.Equals, was)
+	sv.Relaxed = true
+	c.Check(sv.Overlay(b), check.Equals, nil)
+	c.Check(sv.String(), check.Equals, "[0:0 2:1 4:0 5:2 6:0 8:3 12:<nil>]")
+}
+
+func (s *S) TestNewCompact(c *check.C) {
+	rand.Seed(1)
+	const start, end = 0, 50
+	for i := 0; i < 500; i++ {
+		var edits []Step
+		for j := rand.Intn(20); j >= 0; j-- {
+			s := rand.Intn(end - start)
+			edits = append(edits, Step{Start: s, End: s + rand.Intn(end-s+1), Value: Int(rand.Intn(3))})
+		}
+		want, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for _, e := range edits {
+			want.SetRange(e.Start, e.End, e.Value)
+		}
+		got, err := NewCompact(start, end, Int(0), edits)
+		c.Assert(err, check.Equals, nil)
+		c.Check(got.String(), check.Equals, want.String(), check.Commentf("edits: %v", edits))
+		c.Check(got.Count(), check.Equals, want.Count())
+		c.Check(got.min, check.DeepEquals, got.t.Min())
+		c.Check(got.max, check.DeepEquals, got.t.Max())
+		var last Equaler
+		got.Do(func(_, _ int, e Equaler) {
+			c.Check(last != nil && e.Equal(last), check.Equals, false, check.Commentf("non-minimal: %s", got))
+			last = e
+		})
+
+		// The returned vector remains mutable.
+		s := rand.Intn(end - start)
+		e := s + rand.Intn(end-s+1)
+		want.SetRange(s, e, Int(3))
+		got.SetRange(s, e, Int(3))
+		c.Check(got.String(), check.Equals, want.String())
+	}
+
+	sv, err := NewCompact(0, 10, Int(0), []Step{{0, 4, Int(1)}, {2, 6, Int(1)}, {6, 8, Int(0)}, {3, 5, Int(1)}, {9, 10, Int(0)}})
+	c.Assert(err, check.Equals, nil)
+	c.Check(sv.String(), check.Equals, "[0:1 6:0 10:<nil>]")
+	c.Check(sv.Count(), check.Equals, 2)
+
+	for _, t := range []struct {
+		start, end int
+		edits      []Step
+		err        error
+	}{
+		{5, 5, nil, ErrZeroLength},
+		{0, 10, []Step{{4, 2, Int(1)}}, ErrInvertedRange},
+		{0, 10, []Step{{-1, 2, Int(1)}}, &RangeError{Pos: -1, Start: 0, End: 10}},
+		{0, 10, []Step{{8, 11, Int(1)}}, &RangeError{Pos: 10, Start: 0, End: 10}},
+	} {
+		sv, err := NewCompact(t.start, t.end, Int(0), t.edits)
+		c.Check(sv, check.IsNil)
+		c.Check(err, check.DeepEquals, t.err)
+	}
+}
+
+type encodedStep struct {
+	pos int
+	val Equaler
+}
+
+// stepStream returns a next function for Decode that yields the elements of steps.
+func stepStream(steps []encodedStep) func() (int, Equaler, bool, error) {
+	return func() (int, Equaler, bool, error) {
+		if len(steps) == 0 {
+			return 0, nil, false, nil
+		}
+		s := steps[0]
+		steps = steps[1:]
+		return s.pos, s.val, true, nil
+	}
+}
+
+func (s *S) TestEncodeDecode(c *check.C) {
+	rand.Seed(1)
+	const start, end = 0, 50
+	for i := 0; i < 200; i++ {
+		v, err := New(start, end, Int(0))
+		c.Assert(err, check.Equals, nil)
+		for j := rand.Intn(10); j >= 0; j-- {
+			s := rand.Intn(end - start)
+			v.SetRange(s, s+rand.Intn(end-s)+1, Int(rand.Intn(3)))
+		}
+
+		var enc []encodedStep
+		c.Assert(v.Encode(func(pos int, val Equaler) error {
+			enc = append(enc, encodedStep{pos, val})
+			return nil
+		}), check.Equals, nil)
+		c.Check(enc, check.HasLen, v.Count()+1)
+		c.Check(enc[len(enc)-1], check.DeepEquals, encodedStep{end, nil})
+
+		got, err := Decode(start, end, Int(0), stepStream(enc))
+		c.Assert(err, check.Equals, nil)
+		c.Check(got.String(), check.Equals, v.String())
+		c.Check(got.Count(), check.Equals, v.Count())
+		c.Check(got.min, check.DeepEquals, got.t.Min())
+		c.Check(got.max, check.DeepEquals, got.t.Max())
+	}
+
+	v, err := New(0, 10, Int(0))
+	c.Assert(err, check.Equals, nil)
+	v.SetRange(2, 4, Int(1))
+	errStop := errors.New("stop")
+	var n int
+	c.Check(v.Encode(func(int, Equaler) error {
+		n++
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	}), check.Equals, errStop)
+	c.Check(n, check.Equals, 2)
+
+	got, err := Decode(0, 10, Int(0), stepStream([]encodedStep{{0, Int(1)}, {3, Int(1)}, {5, Int(2)}, {10, nil}}))
+	c.Check(err, check.Equals, nil)
+	c.Check(got.String(), check.Equals, "[0:1 5:2 10:<nil>]")
+
+	for _, t := range []struct {
+		start, end int
+		steps      []encodedStep
+		err        error
+	}{
+		{5, 5, nil, ErrZeroLength},
+		{0, 10, nil, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, Int(1)}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, nil}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{1, Int(1)}, {10, nil}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, Int(1)}, {9, nil}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, Int(1)}, {10, Int(2)}, {11, nil}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, Int(1)}, {5, Int(1)}, {3, Int(2)}, {10, nil}}, ErrBadEncoding},
+		{0, 10, []encodedStep{{0, Int(1)}, {0, Int(2)}, {10, nil}}, ErrBadEncoding},
+	} {
+		_, err := Decode(t.start, t.end, Int(0), stepStream(t.steps))
+		c.Check(err, check.Equals, t.err, check.Commentf("steps: %v", t.steps))
+	}
+	_, err = Decode(0, 10, Int(0), func() (int, Equaler, bool, error) { return 0, nil, false, errStop })
+	c.Check(err, check.Equals, errStop)
+}
+
+func (s *S) TestMerge(c *check.C) {
+	add := func(x, y Equaler) Equaler { return x.(Int) + y.(Int) }
+	at := func(v *Vector, i int) Int {
+		e, err := v.At(i)
+		if err != nil {
+			return v.Zero.(Int)
+		}
+		return e.(Int)
+	}
+	rand.Seed(1)
+	for _, ext := range [][4]int{
+		{0, 20, 10, 40},
+		{10, 40, 0, 20},
+		{0, 10, 20, 30},
+		{0, 40, 10, 20},
+		{5, 15, 5, 15},
+	} {
+		for i := 0; i < 50; i++ {
+			a, err := New(ext[0], ext[1], Int(0))
+			c.Assert(err, check.Equals, nil)
+			b, err := New(ext[2], ext[3], Int(1))
+			c.Assert(err, check.Equals, nil)
+			for _, v := range []*Vector{a, b} {
+				for j := 0; j < 5; j++ {
+					s := v.Start() + rand.Intn(v.Len())
+					v.SetRange(s, s+rand.Intn(v.End()-s)+1, Int(rand.Intn(3)))
+				}
+			}
+			m, err := Merge(a, b, add, Int(0))
+			c.Assert(err, check.Equals, nil)
+			start, end := ext[0], ext[1]
+			if ext[2] < start {
+				start = ext[2]
+			}
+			if ext[3] > end {
+				end = ext[3]
+			}
+			c.Check(m.Start(), check.Equals, start)
+			c.Check(m.End(), check.Equals, end)
+			c.Check(m.Zero, check.Equals, Int(0))
+			for p := start; p < end; p++ {
+				c.Check(at(m, p), check.Equals, at(a, p)+at(b, p), check.Commentf("position %d: a=%s b=%s m=%s", p, a, b, m))
+			}
+			var last Equaler
+			m.Do(func(_, _ int, e Equaler) {
+				c.Check(last != nil && e.Equal(last), check.Equals, false, check.Commentf("non-minimal: %s", m))
+				last = e
+			})
+			c.Check(m.min, check.DeepEquals, m.t.Min())
+			c.Check(m.max, check.DeepEquals, m.t.Max())
+		}
+	}
+
+	a, _ := New(0, 10, Int(0))
+	a.SetRange(2, 4, Int(2))
+	b, _ := New(20, 30, Int(1))
+	m, err := Merge(a, b, add, Int(0))
+	c.Assert(err, check.Equals, nil)
+	c.Check(m.String(), check.Equals, "[0:1 2:3 4:1 30:<nil>]")
+
+	_, err = Merge(a, b, func(_, _ Equaler) Equaler { return nil }, Int(0))
+	c.Check(err, check.Equals, ErrTypeMismatch)
+}
+
 func (s *S) TestSetRangeFuzzing(c *check.C) {
 	rand.Seed(2)
 	sv, err := New(0, 1, pair{})
@@ -1531,15 +3008,12 @@ func applyRange(b *testing.B, coverage float64) {
 		start  = 0
 		end    = int(float64(b.N)/coverage) / length
 		zero   = Int(0)
-		pool   = make([]int, b.N)
 	)
 	if end == 0 {
 		return
 	}
 	sv, _ := New(start, end, zero)
-	for i := 0; i < b.N; i++ {
-		pool[i] = rand.Intn(end)
-	}
+	pool := testutil.New(1).Intn(b.N, end)
 	b.StartTimer()
 	for _, r := range pool {
 		sv.ApplyRange(r, r+length, IncInt)
@@ -1580,13 +3054,14 @@ func atFunc(b *testing.B, coverage float64) {
 		return
 	}
 	sv, _ := New(start, end, zero)
-	for i := 0; i < b.N; i++ {
-		r := rand.Intn(end)
+	src := testutil.New(1)
+	for _, r := range src.Intn(b.N, end) {
 		sv.ApplyRange(r, r+length, IncInt)
 	}
+	pool := src.Intn(b.N, end)
 	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		_, err := sv.At(rand.Intn(end))
+	for _, r := range pool {
+		_, err := sv.At(r)
 		if err != nil {
 			panic("cannot reach")
 		}
@@ -1614,3 +3089,43 @@ func BenchmarkAtVSparse(b *testing.B) {
 func BenchmarkAtXSparse(b *testing.B) {
 	atFunc(b, 0.001)
 }
+
+func setRangeUnchanged(b *testing.B, overlap int) {
+	b.StopTimer()
+	const (
+		blocks = 1000
+		width  = 1000
+		island = 10
+	)
+	sv, _ := New(0, blocks*width, Int(0))
+	for i := 0; i < blocks; i++ {
+		sv.SetRange(i*width, i*width+island, Int(1))
+	}
+	pool := testutil.New(1).Intn(b.N, blocks)
+	b.ReportAllocs()
+	b.StartTimer()
+	for _, r := range pool {
+		r *= width
+		sv.SetRange(r+island-overlap, r+width, Int(0))
+		if overlap != 0 {
+			sv.SetRange(r, r+island, Int(1))
+		}
+	}
+}
+func BenchmarkSetRangeEdits(b *testing.B) {
+	b.StopTimer()
+	const end = 1e6
+	sv, _ := New(0, end, Int(0))
+	pool := testutil.New(1).Edits(b.N, 0, end-100, 100, 4)
+	b.StartTimer()
+	for _, e := range pool {
+		sv.SetRange(e.Start, e.End, Int(e.Val))
+	}
+}
+
+func BenchmarkSetRangeUnchanged(b *testing.B) {
+	setRangeUnchanged(b, 0)
+}
+func BenchmarkSetRangeMostlyUnchanged(b *testing.B) {
+	setRangeUnchanged(b, 2)
+}